@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type (
+	// instance is the registration of a checker run by this moncheck in
+	// checker_instances. It counts the checks run and the errors until the
+	// next heartbeat.
+	instance struct {
+		db *sql.DB
+		id int64
+
+		mu            sync.Mutex
+		checks        int64
+		errors        int64
+		lastError     string
+		lastErrorTime time.Time
+	}
+)
+
+// register adds a new instance of the checker to checker_instances.
+func register(db *sql.DB, checkerID int, hostname string, workers int, heartbeat time.Duration) (*instance, error) {
+	i := &instance{db: db}
+	if err := db.QueryRow(`insert into checker_instances(checker_id, hostname, version, workers, heartbeat_intval)
+		values ($1, $2, $3, $4, $5::float8 * interval '1 second')
+		returning id`, checkerID, hostname, BUILD_DATE, workers, heartbeat.Seconds()).
+		Scan(&i.id); err != nil {
+		return nil, fmt.Errorf("could not register instance: %w", err)
+	}
+	return i, nil
+}
+
+// ran counts a run check. The error is remembered when set.
+func (i *instance) ran(err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err != nil {
+		i.errors++
+		i.lastError = err.Error()
+		i.lastErrorTime = time.Now()
+		return
+	}
+	i.checks++
+}
+
+// heartbeat updates the registration with the counters in the interval.
+func (i *instance) heartbeat(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		i.mu.Lock()
+		checks, errors, lastError, lastErrorTime := i.checks, i.errors, i.lastError, i.lastErrorTime
+		i.checks, i.errors, i.lastError = 0, 0, ""
+		i.mu.Unlock()
+
+		if _, err := i.db.Exec(`update checker_instances
+			set checks = checks + $2,
+				rate = $2 / greatest(extract(epoch from now() - heartbeat), 1),
+				heartbeat = now(),
+				errors = errors + $3,
+				last_error = coalesce(nullif($4, ''), last_error),
+				last_error_time = case when $4 = '' then last_error_time else $5 end
+			where id = $1`, i.id, checks, errors, lastError, lastErrorTime); err != nil {
+			log.Printf("could not send heartbeat: %s", err)
+			// keep the counters for the next heartbeat
+			i.mu.Lock()
+			i.checks += checks
+			i.errors += errors
+			if i.lastError == "" {
+				i.lastError, i.lastErrorTime = lastError, lastErrorTime
+			}
+			i.mu.Unlock()
+		}
+	}
+}
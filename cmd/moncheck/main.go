@@ -20,6 +20,9 @@ import (
 
 var (
 	configPath = flag.String("config", "moncheck.conf", "path to the config file")
+	// BUILD_DATE is set while building and reported as the version of the
+	// instance.
+	BUILD_DATE = "unknown"
 )
 
 type (
@@ -30,6 +33,24 @@ type (
 		Path      []string `json:"path"`
 		Workers   int      `json:"workers"`
 		CheckerID int      `json:"checker_id"`
+		// Executor is the executor to run the checks of CheckerID with. It
+		// defaults to moncheck, which runs the command line of the check.
+		Executor string `json:"executor"`
+		// Checkers contains the checkers this instance runs the checks for.
+		// When empty, the checker of CheckerID is run with Workers workers.
+		Checkers []CheckerEntry `json:"checkers"`
+		// Heartbeat is the interval in which every checker updates its
+		// registration in checker_instances.
+		Heartbeat string `json:"heartbeat"`
+	}
+
+	// CheckerEntry selects a checker by its name in the checkers table.
+	CheckerEntry struct {
+		Name string `json:"name"`
+		// Executor is the name of the executor to run the checks with. It
+		// defaults to the name of the checker.
+		Executor string `json:"executor"`
+		Workers  int    `json:"workers"`
 	}
 
 	States []int
@@ -42,7 +63,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not read config: %s", err)
 	}
-	config := Config{Timeout: "30s", Wait: "30s", Workers: 25}
+	config := Config{
+		Timeout:   "30s",
+		Wait:      "30s",
+		Workers:   25,
+		Heartbeat: "30s",
+	}
 	if err := json.Unmarshal(raw, &config); err != nil {
 		log.Fatalf("could not parse config: %s", err)
 	}
@@ -59,6 +85,10 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not parse timeout: %s", err)
 	}
+	heartbeat, err := time.ParseDuration(config.Heartbeat)
+	if err != nil {
+		log.Fatalf("could not parse heartbeat: %s", err)
+	}
 
 	db, err := sql.Open("postgres", config.DB)
 	if err != nil {
@@ -70,31 +100,69 @@ func main() {
 		log.Fatalf("could not resolve hostname: %s", err)
 	}
 
-	checker, err := monzero.NewChecker(monzero.CheckerConfig{
-		CheckerID:      config.CheckerID,
-		DB:             db,
-		Timeout:        timeout,
-		HostIdentifier: hostname,
-		Executor:       monzero.CheckExec,
-	})
-	if err != nil {
-		log.Fatalf("could not create checker instance: %s", err)
+	if len(config.Checkers) == 0 {
+		entry := CheckerEntry{Executor: config.Executor, Workers: config.Workers}
+		if entry.Executor == "" {
+			entry.Executor = "moncheck"
+		}
+		if err := db.QueryRow(`select name from checkers where id = $1`, config.CheckerID).
+			Scan(&entry.Name); err != nil {
+			log.Fatalf("could not find checker '%d': %s", config.CheckerID, err)
+		}
+		config.Checkers = append(config.Checkers, entry)
 	}
 
-	for i := 0; i < config.Workers; i++ {
-		go check(checker, waitDuration)
+	for _, entry := range config.Checkers {
+		if entry.Executor == "" {
+			entry.Executor = entry.Name
+		}
+		executor, err := monzero.DefaultExecutors.Get(entry.Executor)
+		if err != nil {
+			log.Fatalf("could not find executor: %s", err)
+		}
+		var checkerID int
+		if err := db.QueryRow(`select id from checkers where name = $1`, entry.Name).
+			Scan(&checkerID); err != nil {
+			log.Fatalf("could not find checker '%s': %s", entry.Name, err)
+		}
+
+		checker, err := monzero.NewChecker(monzero.CheckerConfig{
+			CheckerID:      checkerID,
+			DB:             db,
+			Timeout:        timeout,
+			HostIdentifier: hostname,
+			Executor:       executor,
+		})
+		if err != nil {
+			log.Fatalf("could not create checker instance for '%s': %s", entry.Name, err)
+		}
+
+		inst, err := register(db, checkerID, hostname, entry.Workers, heartbeat)
+		if err != nil {
+			log.Fatalf("could not register checker '%s': %s", entry.Name, err)
+		}
+		go inst.heartbeat(heartbeat)
+
+		log.Printf("running checker '%s' with %d workers", entry.Name, entry.Workers)
+		for i := 0; i < entry.Workers; i++ {
+			go check(checker, inst, waitDuration)
+		}
 	}
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	wg.Wait()
 }
 
-func check(checker *monzero.Checker, waitDuration time.Duration) {
+func check(checker *monzero.Checker, inst *instance, waitDuration time.Duration) {
 	for {
-		if err := checker.Next(); err != nil {
-			if err != monzero.ErrNoCheck {
-				log.Printf("could not run check: %s", err)
-			}
+		err := checker.Next()
+		if err == monzero.ErrNoCheck {
+			time.Sleep(waitDuration)
+			continue
+		}
+		inst.ran(err)
+		if err != nil {
+			log.Printf("could not run check: %s", err)
 			time.Sleep(waitDuration)
 		}
 	}
@@ -3,7 +3,6 @@ package main
 import (
 	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"fmt"
@@ -11,6 +10,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"git.zero-knowledge.org/gibheer/monzero"
 )
 
 const (
@@ -118,7 +119,6 @@ func (a *Authenticator) Handler() (func(*Context) error, error) {
 	default:
 		return nil, fmt.Errorf("unknown mode '%s' for authentication", a.Mode)
 	}
-	return nil, fmt.Errorf("could not create authenticator")
 }
 
 func (a *Authenticator) Unauthorized(c *Context) error {
@@ -144,9 +144,7 @@ func (a *Authenticator) createSession(user string) (string, error) {
 }
 
 func (a *Authenticator) mac(input []byte) []byte {
-	mac := hmac.New(sha256.New, a.Token)
-	mac.Write(input)
-	return mac.Sum(nil)
+	return monzero.MAC(a.Token, input)
 }
 
 // getSession returns the username of the current session.
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type (
+	// checkerInstance is a registered instance of a checker.
+	checkerInstance struct {
+		Id            int64
+		CheckerId     int
+		CheckerName   string
+		Hostname      string
+		Version       string
+		Workers       int
+		Started       time.Time
+		Heartbeat     time.Time
+		Alive         bool
+		Checks        int64
+		Rate          float64
+		Errors        int64
+		LastError     sql.NullString
+		LastErrorTime pq.NullTime
+	}
+)
+
+// showCheckers lists all registered checker instances, the live ones first.
+func showCheckers(con *Context) {
+	if con.r.Method != "GET" {
+		con.w.WriteHeader(http.StatusMethodNotAllowed)
+		con.w.Write([]byte("method is not supported"))
+		return
+	}
+
+	query := `select i.id, c.id, c.name, i.hostname, i.version, i.workers, i.started,
+		i.heartbeat, i.alive, i.checks, i.rate, i.errors, i.last_error, i.last_error_time
+	from checker_instances_alive i
+	join checkers c on i.checker_id = c.id
+	order by alive desc, c.name, i.hostname, i.started desc`
+	rows, err := DB.Query(query)
+	if err != nil {
+		log.Printf("could not load checker instances: %s", err)
+		con.Error = "could not load checker instances"
+		returnError(http.StatusInternalServerError, con, con.w)
+		return
+	}
+	defer rows.Close()
+	con.Instances = []checkerInstance{}
+	for rows.Next() {
+		i := checkerInstance{}
+		if err := rows.Scan(&i.Id, &i.CheckerId, &i.CheckerName, &i.Hostname, &i.Version,
+			&i.Workers, &i.Started, &i.Heartbeat, &i.Alive, &i.Checks, &i.Rate, &i.Errors,
+			&i.LastError, &i.LastErrorTime); err != nil {
+			log.Printf("could not scan checker instances: %s", err)
+			con.Error = "could not load checker instances"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		con.Instances = append(con.Instances, i)
+	}
+
+	con.w.Header()["Content-Type"] = []string{"text/html"}
+	con.Render("checkers")
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
@@ -11,19 +12,32 @@ import (
 
 type (
 	check struct {
-		NodeId      int
-		NodeName    string
-		CommandName string
-		CheckID     int64
-		CheckName   string
-		MappingId   int
-		State       int
-		Enabled     bool
-		Notify      bool
-		Notice      sql.NullString
-		NextTime    time.Time
-		Msg         string
-		StateSince  time.Time
+		NodeId       int
+		NodeName     string
+		CommandName  string
+		CheckID      int64
+		CheckName    string
+		MappingId    int
+		State        int
+		Enabled      bool
+		Notify       bool
+		Notice       sql.NullString
+		NextTime     time.Time
+		Msg          string
+		StateSince   time.Time
+		Soft         bool
+		Attempt      int
+		MaxAttempts  int
+		Flapping     bool
+		InDowntime   bool
+		Acknowledged bool
+		Ack          *acknowledgement
+		// LastRun is the time of the last result, Duration the seconds it
+		// took and ExecutedBy the host which ran the check.
+		LastRun    pq.NullTime
+		Duration   sql.NullFloat64
+		ExecutedBy sql.NullString
+		Slow       bool
 	}
 
 	checkDetails struct {
@@ -44,12 +58,60 @@ type (
 		CommandLine    []string
 		CommandMessage string
 		States         []int64
+		HardState      int
+		Attempt        int
+		MaxAttempts    int
+		Flapping       bool
 		Notice         sql.NullString
-		Notifiers      []notifier
-		Notifications  []notification
-		CheckerID      int
-		CheckerName    string
-		CheckerMsg     string
+		Acknowledged   bool
+		Ack            *acknowledgement
+		// EscalationPolicy is the name of the escalation policy of the check
+		// and EscalationStep the last escalated step of the current problem.
+		EscalationPolicy sql.NullString
+		EscalationStep   int
+		LastRun          pq.NullTime
+		Duration         sql.NullFloat64
+		ExecutedBy       sql.NullString
+		// Slow is set, when the check regularly uses most of its timeout.
+		Slow          bool
+		Notifiers     []notifier
+		Notifications []notification
+		// Results is the page of the result history in the selected range,
+		// Availability the percentage of the range the check was okay.
+		Results      []result
+		ResultRange  string
+		ResultRanges []resultRange
+		ResultPage   int
+		MoreResults  bool
+		Availability sql.NullFloat64
+		CheckerID    int
+		CheckerName  string
+		CheckerMsg   string
+	}
+
+	// acknowledgement contains who acknowledged a check, when and why.
+	acknowledgement struct {
+		Author  string
+		Comment string
+		Time    time.Time
+		Expires pq.NullTime
+		Sticky  bool
+	}
+
+	// result is a single entry of the result history of a check.
+	result struct {
+		Time     time.Time
+		ExitCode int
+		State    int
+		Duration float64
+		Output   string
+		Host     string
+	}
+
+	// resultRange is a selectable range of the result history.
+	resultRange struct {
+		Name     string
+		Interval string
 	}
 
 	notifier struct {
@@ -59,16 +121,39 @@ type (
 	}
 
 	notification struct {
-		Id           int64
-		State        int
-		Output       string
-		Inserted     time.Time
-		Sent         pq.NullTime
-		NotifierName string
-		MappingId    int
+		Id             int64
+		State          int
+		Output         string
+		Inserted       time.Time
+		Sent           pq.NullTime
+		NotifierName   string
+		MappingId      int
+		Status         string
+		Attempts       int
+		LastError      sql.NullString
+		NextTry        pq.NullTime
+		ResultCode     sql.NullInt64
+		ResultOutput   sql.NullString
+		EscalationStep sql.NullInt64
+		DigestID       sql.NullInt64
+	}
+)
+
+var (
+	resultRanges = []resultRange{
+		{"1d", "1 day"},
+		{"7d", "7 days"},
+		{"30d", "30 days"},
+		{"365d", "365 days"},
 	}
 )
 
+const (
+	// resultsPerPage is the number of results shown on a page of the
+	// result history.
+	resultsPerPage = 50
+)
+
 // showCheck loads shows the notifications for a specific check.
 func showCheck(con *Context) {
 	cd := checkDetails{}
@@ -81,19 +166,28 @@ func showCheck(con *Context) {
 	}
 	query := `select c.id, c.name, c.message, c.enabled, c.updated, c.last_refresh,
 		m.id, m.name, n.id, n.name, n.message, co.id, co.Name, co.message,
-		ac.cmdline, ac.states, ac.msg, ac.next_time, ch.id, ch.name, ch.description
+		ac.cmdline, ac.states, ac.msg, ac.next_time, ch.id, ch.name, ch.description,
+		ac.hard_state, ac.attempt, ac.max_attempts, ac.flapping, ac.acknowledged,
+		ac.ack_author, ac.ack_comment, ac.ack_time, ac.ack_expires, ac.ack_sticky,
+		ep.name, ac.escalation_step, ac.last_run, extract(epoch from ac.duration),
+		ac.executed_by, ac.slow
 	from checks c
 	join active_checks ac on c.id = ac.check_id
 	join nodes n on c.node_id = n.id
 	join commands co on c.command_id = co.id
 	join mappings m on ac.mapping_id = m.id
 	join checkers ch on c.checker_id = ch.id
+	left join escalation_policies ep on c.escalation_policy_id = ep.id
 	where c.id = $1::bigint`
+	ack := ackScanner{}
 	err := DB.QueryRow(query, id[0]).Scan(&cd.Id, &cd.Name, &cd.Message, &cd.Enabled,
 		&cd.Updated, &cd.LastRefresh, &cd.MappingId, &cd.MappingName, &cd.NodeId,
 		&cd.NodeName, &cd.NodeMessage, &cd.CommandId, &cd.CommandName, &cd.CommandMessage,
 		pq.Array(&cd.CommandLine), pq.Array(&cd.States), &cd.Notice, &cd.NextTime,
-		&cd.CheckerID, &cd.CheckerName, &cd.CheckerMsg)
+		&cd.CheckerID, &cd.CheckerName, &cd.CheckerMsg, &cd.HardState, &cd.Attempt,
+		&cd.MaxAttempts, &cd.Flapping, &cd.Acknowledged, &ack.author, &ack.comment,
+		&ack.time, &ack.expires, &ack.sticky, &cd.EscalationPolicy, &cd.EscalationStep,
+		&cd.LastRun, &cd.Duration, &cd.ExecutedBy, &cd.Slow)
 	if err != nil && err == sql.ErrNoRows {
 		con.w.Header()["Location"] = []string{"/"}
 		con.w.WriteHeader(http.StatusSeeOther)
@@ -104,8 +198,11 @@ func showCheck(con *Context) {
 		log.Printf("could not get check details for check id %s: %s", id[0], err)
 		return
 	}
+	cd.Ack = ack.acknowledgement()
 
-	query = `select n.id, states[1], output, inserted, sent, no.name, n.mapping_id
+	query = `select n.id, states[1], output, inserted, sent, no.name, n.mapping_id,
+		n.status, n.attempts, n.last_error, n.next_try, n.result_code, n.result_output,
+		n.escalation_step, n.digest_id
 		from notifications n
 		join notifier no on n.notifier_id = no.id
 		where check_id = $1::bigint
@@ -129,7 +226,9 @@ func showCheck(con *Context) {
 		}
 		no := notification{}
 		if err := rows.Scan(&no.Id, &no.State, &no.Output, &no.Inserted,
-			&no.Sent, &no.NotifierName, &no.MappingId); err != nil {
+			&no.Sent, &no.NotifierName, &no.MappingId, &no.Status, &no.Attempts,
+			&no.LastError, &no.NextTry, &no.ResultCode, &no.ResultOutput,
+			&no.EscalationStep, &no.DigestID); err != nil {
 			log.Printf("could not scan notifications: %s", err)
 			con.Error = "could not load notification information"
 			returnError(http.StatusInternalServerError, con, con.w)
@@ -138,6 +237,13 @@ func showCheck(con *Context) {
 		cd.Notifications = append(cd.Notifications, no)
 	}
 
+	if err := cd.loadResults(con); err != nil {
+		log.Printf("could not load results: %s", err)
+		con.Error = "could not load result history"
+		returnError(http.StatusInternalServerError, con, con.w)
+		return
+	}
+
 	if err := con.loadMappings(); err != nil {
 		con.w.WriteHeader(http.StatusInternalServerError)
 		con.w.Write([]byte("problem with the mappings"))
@@ -153,7 +259,10 @@ func showChecks(con *Context) {
 	query := `select c.id, c.name, n.id, n.name, co.name, ac.mapping_id, ac.states[1] as state,
 	ac.enabled, ac.notice, ac.next_time, ac.msg,
 	case when cn.check_id is null then false else true end as notify_enabled,
-	state_since
+	state_since, ac.states[1] != ac.hard_state as soft, ac.attempt, ac.max_attempts,
+	ac.flapping, check_in_downtime(c.id) as in_downtime,
+	ac.acknowledged, ac.ack_author, ac.ack_comment, ac.ack_time, ac.ack_expires, ac.ack_sticky,
+	ac.last_run, extract(epoch from ac.duration), ac.executed_by, ac.slow
   from active_checks ac
 	join checks c on ac.check_id = c.id
 	join nodes n on c.node_id = n.id
@@ -196,14 +305,19 @@ func showChecks(con *Context) {
 	checks := []check{}
 	for rows.Next() {
 		c := check{}
+		ack := ackScanner{}
 		err := rows.Scan(&c.CheckID, &c.CheckName, &c.NodeId, &c.NodeName, &c.CommandName, &c.MappingId,
-			&c.State, &c.Enabled, &c.Notice, &c.NextTime, &c.Msg, &c.Notify, &c.StateSince)
+			&c.State, &c.Enabled, &c.Notice, &c.NextTime, &c.Msg, &c.Notify, &c.StateSince,
+			&c.Soft, &c.Attempt, &c.MaxAttempts, &c.Flapping, &c.InDowntime, &c.Acknowledged,
+			&ack.author, &ack.comment, &ack.time, &ack.expires, &ack.sticky,
+			&c.LastRun, &c.Duration, &c.ExecutedBy, &c.Slow)
 		if err != nil {
 			con.w.WriteHeader(http.StatusInternalServerError)
 			returnError(http.StatusInternalServerError, con, con.w)
 			log.Printf("could not get check list: %s", err)
 			return
 		}
+		c.Ack = ack.acknowledgement()
 		checks = append(checks, c)
 	}
 	con.Checks = checks
@@ -224,3 +338,88 @@ func showChecks(con *Context) {
 	con.Render("checklist")
 	return
 }
+
+// loadResults loads the page of the result history and the availability in
+// the range selected through the parameters range and page.
+func (cd *checkDetails) loadResults(con *Context) error {
+	cd.ResultRanges = resultRanges
+	cd.ResultRange = resultRanges[1].Name
+	interval := resultRanges[1].Interval
+	for _, r := range resultRanges {
+		if r.Name == con.r.URL.Query().Get("range") {
+			cd.ResultRange = r.Name
+			interval = r.Interval
+		}
+	}
+	if page, err := strconv.Atoi(con.r.URL.Query().Get("page")); err == nil && page > 0 {
+		cd.ResultPage = page
+	}
+
+	query := `select r.time, r.exit_code, coalesce(ml.target, r.exit_code),
+		extract(epoch from r.duration), r.output, r.host
+	from check_results r
+	left join mapping_level ml on ml.mapping_id = $2 and ml.source = r.exit_code
+	where r.check_id = $1 and r.time >= now() - $3::interval
+	order by r.time desc
+	limit $4 offset $5`
+	rows, err := DB.Query(query, cd.Id, cd.MappingId, interval,
+		resultsPerPage+1, cd.ResultPage*resultsPerPage)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cd.Results = []result{}
+	for rows.Next() {
+		r := result{}
+		if err := rows.Scan(&r.Time, &r.ExitCode, &r.State, &r.Duration, &r.Output, &r.Host); err != nil {
+			return err
+		}
+		cd.Results = append(cd.Results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(cd.Results) > resultsPerPage {
+		cd.MoreResults = true
+		cd.Results = cd.Results[:resultsPerPage]
+	}
+
+	// Every result counts until the next result, the last one until now.
+	// The availability is only unknown, when there are no results in the
+	// range.
+	query = `select 100 * coalesce(sum(extract(epoch from until - time)) filter (where state = 0), 0)
+		/ nullif(sum(extract(epoch from until - time)), 0)
+	from (select r.time, lead(r.time, 1, now()) over (order by r.time) as until,
+			coalesce(ml.target, r.exit_code) as state
+		from check_results r
+		left join mapping_level ml on ml.mapping_id = $2 and ml.source = r.exit_code
+		where r.check_id = $1 and r.time >= now() - $3::interval) r`
+	if err := DB.QueryRow(query, cd.Id, cd.MappingId, interval).Scan(&cd.Availability); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ackScanner receives the nullable acknowledgement columns of a check.
+type ackScanner struct {
+	author  sql.NullString
+	comment sql.NullString
+	time    pq.NullTime
+	expires pq.NullTime
+	sticky  bool
+}
+
+// acknowledgement returns the acknowledgement of a check or nil, when the
+// check was acknowledged without any details or not at all.
+func (a ackScanner) acknowledgement() *acknowledgement {
+	if !a.author.Valid {
+		return nil
+	}
+	return &acknowledgement{
+		Author:  a.author.String,
+		Comment: a.comment.String,
+		Time:    a.time.Time,
+		Expires: a.expires,
+		Sticky:  a.sticky,
+	}
+}
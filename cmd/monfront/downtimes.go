@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type (
+	downtime struct {
+		Id         int64
+		TargetType string
+		TargetId   int64
+		TargetName string
+		Starts     time.Time
+		Ends       time.Time
+		Author     string
+		Comment    string
+		Created    time.Time
+	}
+)
+
+// showDowntimes lists all current and upcoming downtimes.
+func showDowntimes(con *Context) {
+	if con.r.Method == "POST" {
+		changeDowntimes(con)
+		return
+	}
+	if con.r.Method != "GET" {
+		con.w.WriteHeader(http.StatusMethodNotAllowed)
+		con.w.Write([]byte("method is not supported"))
+		return
+	}
+
+	query := `select d.id, d.starts, d.ends, d.author, d.comment, d.created,
+		case when d.check_id is not null then 'check'
+			when d.node_id is not null then 'node'
+			else 'group' end,
+		coalesce(d.check_id, d.node_id, d.group_id),
+		coalesce(n.name || ' ' || c.name, nn.name, g.name, '')
+	from downtimes d
+	left join checks c on d.check_id = c.id
+	left join nodes n on c.node_id = n.id
+	left join nodes nn on d.node_id = nn.id
+	left join groups g on d.group_id = g.id
+	where d.ends >= now()
+	order by d.starts, d.ends`
+	rows, err := DB.Query(query)
+	if err != nil {
+		log.Printf("could not load downtimes: %s", err)
+		con.Error = "could not load downtimes"
+		returnError(http.StatusInternalServerError, con, con.w)
+		return
+	}
+	defer rows.Close()
+	con.Downtimes = []downtime{}
+	for rows.Next() {
+		d := downtime{}
+		if err := rows.Scan(&d.Id, &d.Starts, &d.Ends, &d.Author, &d.Comment, &d.Created,
+			&d.TargetType, &d.TargetId, &d.TargetName); err != nil {
+			log.Printf("could not scan downtimes: %s", err)
+			con.Error = "could not load downtimes"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		con.Downtimes = append(con.Downtimes, d)
+	}
+
+	con.Content = map[string]any{}
+	primitives := []struct {
+		name  string
+		query string
+	}{
+		{"nodes", "select id, name from nodes order by name"},
+		{"groups", "select id, name from groups order by name"},
+	}
+	for _, prim := range primitives {
+		rows, err := DB.Query(prim.query)
+		if err != nil {
+			log.Printf("could not get %s: %s", prim.name, err)
+			con.Error = "could not get " + prim.name
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		defer rows.Close()
+		result, err := rowsToResult(rows)
+		if err != nil {
+			log.Printf("could not get %s: %s", prim.name, err)
+			con.Error = "could not get " + prim.name
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		con.Content[prim.name] = result
+	}
+
+	con.w.Header()["Content-Type"] = []string{"text/html"}
+	con.Render("downtimes")
+}
+
+// changeDowntimes creates or cancels a downtime.
+func changeDowntimes(con *Context) {
+	if !con.CanEdit {
+		con.w.WriteHeader(http.StatusForbidden)
+		con.w.Write([]byte("no permission to change data"))
+		return
+	}
+	if err := con.r.ParseForm(); err != nil {
+		con.w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(con.w, "could not parse parameters: %s", err)
+		return
+	}
+	con.w.Header()["Location"] = []string{"/downtimes"}
+
+	switch con.r.PostForm.Get("action") {
+	case "cancel":
+		id, err := strconv.ParseInt(con.r.PostForm.Get("id"), 10, 64)
+		if err != nil {
+			con.Error = "id is not a valid downtime"
+			returnError(http.StatusBadRequest, con, con.w)
+			return
+		}
+		if _, err := DB.Exec(`delete from downtimes where id = $1`, id); err != nil {
+			log.Printf("could not cancel downtime: %s", err)
+			con.Error = "could not cancel downtime"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+	case "create":
+		column := ""
+		target := ""
+		switch con.r.PostForm.Get("target") {
+		case "check":
+			column, target = "check_id", con.r.PostForm.Get("check_id")
+		case "node":
+			column, target = "node_id", con.r.PostForm.Get("node_id")
+		case "group":
+			column, target = "group_id", con.r.PostForm.Get("group_id")
+		default:
+			con.Error = "unknown downtime target"
+			returnError(http.StatusBadRequest, con, con.w)
+			return
+		}
+		if _, err := strconv.ParseInt(target, 10, 64); err != nil {
+			con.Error = "target is not a valid id"
+			returnError(http.StatusBadRequest, con, con.w)
+			return
+		}
+		starts := time.Now()
+		if raw := con.r.PostForm.Get("starts"); raw != "" {
+			var err error
+			starts, err = time.ParseInLocation("2006-01-02T15:04", raw, time.Local)
+			if err != nil {
+				con.Error = "start is not a valid time"
+				returnError(http.StatusBadRequest, con, con.w)
+				return
+			}
+		}
+		duration, err := strconv.Atoi(con.r.PostForm.Get("duration"))
+		if err != nil || duration <= 0 {
+			con.Error = "duration is not a valid number of minutes"
+			returnError(http.StatusBadRequest, con, con.w)
+			return
+		}
+		comment := con.r.PostForm.Get("comment")
+		if comment == "" {
+			con.Error = "comment must not be empty"
+			returnError(http.StatusBadRequest, con, con.w)
+			return
+		}
+		author := con.User
+		if author == "" {
+			author = UserAnonymous
+		}
+		_, err = DB.Exec(`insert into downtimes(`+column+`, starts, ends, author, comment)
+			values ($1::bigint, $2, $3, $4, $5)`,
+			target, starts, starts.Add(time.Duration(duration)*time.Minute), author, comment)
+		if err != nil {
+			log.Printf("could not create downtime: %s", err)
+			con.Error = "could not create downtime"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+	default:
+		con.Error = "unknown action"
+		returnError(http.StatusBadRequest, con, con.w)
+		return
+	}
+	con.w.WriteHeader(http.StatusSeeOther)
+}
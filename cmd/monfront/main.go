@@ -16,6 +16,7 @@ import (
 	"strings"
 	"time"
 
+	"git.zero-knowledge.org/gibheer/monzero"
 	"github.com/BurntSushi/toml"
 	"github.com/lib/pq"
 	"golang.org/x/crypto/ssh/terminal"
@@ -105,6 +106,23 @@ func main() {
 	}
 	DB = db
 
+	passiveID := 0
+	if err := db.QueryRow(`select id from checkers where name = 'passive'`).Scan(&passiveID); err != nil {
+		log.Fatalf("could not find checker 'passive': %s", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("could not resolve hostname: %s", err)
+	}
+	Passive, err = monzero.NewChecker(monzero.CheckerConfig{
+		CheckerID:      passiveID,
+		DB:             db,
+		HostIdentifier: hostname,
+	})
+	if err != nil {
+		log.Fatalf("could not create passive checker: %s", err)
+	}
+
 	authenticator := Authenticator{
 		db:             db,
 		Mode:           config.Authentication.Mode,
@@ -175,6 +193,9 @@ func main() {
 	s.Handle("/checks", showChecks)
 	s.Handle("/groups", showGroups)
 	s.Handle("/action", checkAction)
+	s.Handle("/downtimes", showDowntimes)
+	s.Handle("/checkers", showCheckers)
+	s.Handle("/submit", submitResult)
 	s.HandleStatic("/static/", showStatic)
 	log.Fatalf("http server stopped: %s", s.ListenAndServe())
 }
@@ -254,13 +275,25 @@ func checkAction(con *Context) {
 		}
 		setTable = "active_checks"
 	case "deack":
-		setClause = "acknowledged = false"
+		setClause = `acknowledged = false, ack_author = null, ack_comment = null,
+			ack_time = null, ack_expires = null, ack_sticky = false`
 		setTable = "active_checks"
 	case "ack":
-		setClause = "acknowledged = true"
-		setTable = "active_checks"
-		whereFields = append(whereFields, "states[0]")
-		whereVals = append(whereVals, 0)
+		author := con.User
+		if author == "" {
+			author = UserAnonymous
+		}
+		expire := 0
+		if raw := con.r.PostForm.Get("ack_expire"); raw != "" {
+			var err error
+			expire, err = strconv.Atoi(raw)
+			if err != nil || expire < 0 {
+				con.Error = "ack expire is not a valid number of minutes"
+				returnError(http.StatusBadRequest, con, con.w)
+				return
+			}
+		}
+		sticky := con.r.PostForm.Get("ack_sticky") != ""
 
 		hostname, err := os.Hostname()
 		if err != nil {
@@ -269,17 +302,57 @@ func checkAction(con *Context) {
 			returnError(http.StatusInternalServerError, con, con.w)
 			return
 		}
-		if _, err := DB.Exec(`insert into notifications(check_id, states, output, mapping_id, notifier_id, check_host)
-			select ac.check_id, 0 || states[1:4], 'check acknowledged', ac.mapping_id,
-			cn.notifier_id, $2
+		tx, err := DB.Begin()
+		if err != nil {
+			log.Printf("could not start transaction: %s", err)
+			con.Error = "could not acknowledge check"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		defer tx.Rollback()
+		// Only checks which are not okay can be acknowledged.
+		if _, err := tx.Exec(`update active_checks
+			set acknowledged = true,
+				ack_author = $2,
+				ack_comment = nullif($3, ''),
+				ack_time = now(),
+				ack_expires = case when $4::int > 0 then now() + $4::int * interval '1 minute' end,
+				ack_sticky = $5
+			where check_id = any ($1::bigint[])
+				and states[1] != 0`,
+			pq.Array(&checks), author, comment, expire, sticky); err != nil {
+			log.Printf("could not acknowledge check: %s", err)
+			con.Error = "could not acknowledge check"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		// now() is the start of the transaction, so only the checks
+		// acknowledged above get a notification.
+		output := "check acknowledged by " + author
+		if comment != "" {
+			output += ": " + comment
+		}
+		if _, err := tx.Exec(`insert into notifications(check_id, states, output, mapping_id, notifier_id, check_host)
+			select ac.check_id, 0 || states[1:4], $2, ac.mapping_id,
+			cn.notifier_id, $3
 			from checks_notify cn
 			join active_checks ac on cn.check_id = ac.check_id
-			where cn.check_id = any ($1::bigint[])`, pq.Array(&checks), &hostname); err != nil {
+			where cn.check_id = any ($1::bigint[])
+				and ac.acknowledged
+				and ac.ack_time = now()`, pq.Array(&checks), output, &hostname); err != nil {
 			log.Printf("could not acknowledge check: %s", err)
 			con.Error = "could not acknowledge check"
 			returnError(http.StatusInternalServerError, con, con.w)
 			return
 		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("could not acknowledge check: %s", err)
+			con.Error = "could not acknowledge check"
+			returnError(http.StatusInternalServerError, con, con.w)
+			return
+		}
+		con.w.WriteHeader(http.StatusSeeOther)
+		return
 	case "comment":
 		if comment == "" {
 			con.w.WriteHeader(http.StatusSeeOther)
@@ -309,7 +382,7 @@ func checkAction(con *Context) {
 		con.w.WriteHeader(http.StatusSeeOther)
 		return
 	default:
-		con.Error = fmt.Sprintf("requested action '%s' does not exist", action[0])
+		con.Error = fmt.Sprintf("requested action '%s' does not exist", action)
 		returnError(http.StatusNotFound, con, con.w)
 		return
 	}
@@ -319,14 +392,12 @@ func checkAction(con *Context) {
 	}
 
 	sql := "update " + setTable + " set " + setClause + " where " + whereColumn + " = any($1::bigint[])"
-	if len(whereFields) > 0 {
-		whereVals = append([]any{pq.Array(&checks)}, whereVals...)
-		for i, column := range whereFields {
-			sql = sql + " and " + column + fmt.Sprintf(" = $%d", i+1)
-		}
+	whereVals = append([]any{pq.Array(&checks)}, whereVals...)
+	for i, column := range whereFields {
+		sql = sql + " and " + column + fmt.Sprintf(" = $%d", i+2)
 	}
 
-	_, err := DB.Exec(sql, whereVals)
+	_, err := DB.Exec(sql, whereVals...)
 	if err != nil {
 		con.w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(con.w, "could not store changes")
@@ -422,14 +493,19 @@ var (
 var (
 	Templates = map[string]string{}
 	Static    = map[string]string{
-		"icon-mute":   `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 35.3 35.3" version="1.1"><title>Check is muted</title><style>.s0{fill:#191919;}</style><g transform="translate(0,-261.72223)"><path d="m17.6 261.7v35.3L5.3 284.7H0v-10.6l5.3 0zM30.2 273.1l-3.7 3.7-3.7-3.7-2.5 2.5 3.7 3.7-3.7 3.7 2.5 2.5 3.7-3.7 3.7 3.7 2.5-2.5-3.7-3.7 3.7-3.7z" fill="#191919"/></g></svg>`,
-		"icon-notice": `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" width="36" height="36"><path d="M2.572.19h30.857c1.319 0 2.38 1.356 2.38 3.041v19.98c0 1.685-1.061 3.04-2.38 3.04H15.941L4 35.81v-9.56H2.572C1.252 26.252.19 24.897.19 23.212V3.232C.19 1.545 1.252.19 2.57.19z" stroke="#000" stroke-width=".38" stroke-linejoin="round"/></svg>`,
-		"error":       `{{ template "header" . }}{{ template "footer" . }}`,
+		"icon-mute":     `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 35.3 35.3" version="1.1"><title>Check is muted</title><style>.s0{fill:#191919;}</style><g transform="translate(0,-261.72223)"><path d="m17.6 261.7v35.3L5.3 284.7H0v-10.6l5.3 0zM30.2 273.1l-3.7 3.7-3.7-3.7-2.5 2.5 3.7 3.7-3.7 3.7 2.5 2.5 3.7-3.7 3.7 3.7 2.5-2.5-3.7-3.7 3.7-3.7z" fill="#191919"/></g></svg>`,
+		"icon-notice":   `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" width="36" height="36"><path d="M2.572.19h30.857c1.319 0 2.38 1.356 2.38 3.041v19.98c0 1.685-1.061 3.04-2.38 3.04H15.941L4 35.81v-9.56H2.572C1.252 26.252.19 24.897.19 23.212V3.232C.19 1.545 1.252.19 2.57.19z" stroke="#000" stroke-width=".38" stroke-linejoin="round"/></svg>`,
+		"icon-ack":      `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 36 36" version="1.1"><title>Check is acknowledged</title><path d="M5 19l8 8 18-18" fill="none" stroke="#191919" stroke-width="3.5" stroke-linejoin="round" stroke-linecap="round"/></svg>`,
+		"icon-downtime": `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 36 36" version="1.1"><title>Check is in a downtime</title><circle cx="18" cy="18" r="15" fill="none" stroke="#191919" stroke-width="3.5"/><path d="M18 9v9l6 6" fill="none" stroke="#191919" stroke-width="3.5" stroke-linecap="round"/></svg>`,
+		"icon-flapping": `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 36 36" version="1.1"><title>Check is flapping</title><path d="M1 27l7-18 7 18 7-18 7 18 6-15" fill="none" stroke="#191919" stroke-width="3.5" stroke-linejoin="round" stroke-linecap="round"/></svg>`,
+		"error":         `{{ template "header" . }}{{ template "footer" . }}`,
 	}
 	TmplUnhandledGroups = `TODO`
 	Funcs               = template.FuncMap{
 		"int":       func(in int64) int { return int(in) },
+		"int64":     func(in int) int64 { return int64(in) },
 		"sub":       func(base, amount int) int { return base - amount },
+		"add":       func(base, amount int) int { return base + amount },
 		"in":        func(t time.Time) time.Duration { return t.Sub(time.Now()).Round(1 * time.Second) },
 		"since":     func(t time.Time) time.Duration { return time.Now().Sub(t).Round(1 * time.Second) },
 		"now":       func() time.Time { return time.Now() },
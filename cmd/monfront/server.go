@@ -45,6 +45,8 @@ type (
 		Checks       []check                  `json:"checks,omitempty"`
 		CheckDetails *checkDetails            `json:"check_details,omitempty"`
 		Groups       []group                  `json:"groups,omitempty"`
+		Downtimes    []downtime               `json:"downtimes,omitempty"`
+		Instances    []checkerInstance        `json:"instances,omitempty"`
 		Unhandled    bool                     `json:"-"` // set this flag when unhandled was called
 
 		Content map[string]any `json:"-"` // used for the configuration dashboard
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"git.zero-knowledge.org/gibheer/monzero"
+)
+
+type (
+	// submission is the result of a passive check sent to /submit.
+	// The check is selected through the check id or the node and check
+	// name.
+	submission struct {
+		CheckID  int64     `json:"check_id"`
+		Node     string    `json:"node"`
+		Check    string    `json:"check"`
+		ExitCode *int      `json:"exit_code"`
+		Output   string    `json:"output"`
+		PerfData []perfVal `json:"perfdata"`
+		// Host is the source of the result. It defaults to the address of
+		// the client.
+		Host string `json:"host"`
+	}
+
+	// perfVal is a single value of the performance data of a submission.
+	perfVal struct {
+		Label string   `json:"label"`
+		Value float64  `json:"value"`
+		Unit  string   `json:"unit"`
+		Warn  string   `json:"warn"`
+		Crit  string   `json:"crit"`
+		Min   *float64 `json:"min"`
+		Max   *float64 `json:"max"`
+	}
+)
+
+var (
+	// Passive is the checker storing the results of passive checks.
+	Passive *monzero.Checker
+)
+
+// submitResult stores the result of a passive check.
+func submitResult(con *Context) {
+	if con.r.Method != "POST" {
+		con.w.WriteHeader(http.StatusMethodNotAllowed)
+		con.w.Write([]byte("method is not supported"))
+		return
+	}
+	if !con.CanEdit {
+		con.w.WriteHeader(http.StatusForbidden)
+		con.w.Write([]byte("no permission to submit results"))
+		return
+	}
+	sub := submission{}
+	if err := json.NewDecoder(con.r.Body).Decode(&sub); err != nil {
+		con.w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(con.w, "could not parse submission: %s", err)
+		return
+	}
+	if sub.ExitCode == nil {
+		con.w.WriteHeader(http.StatusBadRequest)
+		con.w.Write([]byte("exit_code must be set"))
+		return
+	}
+	if sub.CheckID == 0 {
+		if sub.Node == "" || sub.Check == "" {
+			con.w.WriteHeader(http.StatusBadRequest)
+			con.w.Write([]byte("check_id or node and check must be set"))
+			return
+		}
+		// Names are not unique, so only passive checks are considered and
+		// ambiguous names are rejected.
+		rows, err := DB.Query(`select c.id from checks c
+			join nodes n on c.node_id = n.id
+			join checkers ch on c.checker_id = ch.id
+			where n.name = $1 and c.name = $2 and ch.name = 'passive'`, sub.Node, sub.Check)
+		if err != nil {
+			log.Printf("could not find check '%s' of node '%s': %s", sub.Check, sub.Node, err)
+			con.w.WriteHeader(http.StatusInternalServerError)
+			con.w.Write([]byte("could not find check"))
+			return
+		}
+		defer rows.Close()
+		found := 0
+		for rows.Next() {
+			if err := rows.Scan(&sub.CheckID); err != nil {
+				log.Printf("could not scan check id: %s", err)
+				con.w.WriteHeader(http.StatusInternalServerError)
+				con.w.Write([]byte("could not find check"))
+				return
+			}
+			found++
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("could not find check '%s' of node '%s': %s", sub.Check, sub.Node, err)
+			con.w.WriteHeader(http.StatusInternalServerError)
+			con.w.Write([]byte("could not find check"))
+			return
+		}
+		if found == 0 {
+			con.w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(con.w, "passive check '%s' of node '%s' not found", sub.Check, sub.Node)
+			return
+		} else if found > 1 {
+			con.w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(con.w, "passive check '%s' of node '%s' is not unique, use check_id", sub.Check, sub.Node)
+			return
+		}
+	}
+	if sub.Host == "" {
+		sub.Host = con.r.RemoteAddr
+		if host, _, err := net.SplitHostPort(con.r.RemoteAddr); err == nil {
+			sub.Host = host
+		}
+	}
+
+	result := monzero.CheckResult{ExitCode: *sub.ExitCode}
+	result.Message, result.PerfData = monzero.ParsePerfData(sub.Output)
+	for _, p := range sub.PerfData {
+		if p.Label == "" {
+			continue
+		}
+		result.PerfData = append(result.PerfData, monzero.PerfData{
+			Label: p.Label, Value: p.Value, Unit: p.Unit,
+			Warn: p.Warn, Crit: p.Crit, Min: p.Min, Max: p.Max,
+		})
+	}
+
+	if err := Passive.Submit(sub.CheckID, result, sub.Host); err == monzero.ErrNoCheck {
+		con.w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(con.w, "passive check '%d' not found", sub.CheckID)
+		return
+	} else if err != nil {
+		log.Printf("could not submit result of check '%d': %s", sub.CheckID, err)
+		con.w.WriteHeader(http.StatusInternalServerError)
+		con.w.Write([]byte("could not store result"))
+		return
+	}
+	con.w.WriteHeader(http.StatusNoContent)
+}
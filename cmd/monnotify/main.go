@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"git.zero-knowledge.org/gibheer/monzero"
+)
+
+var (
+	configPath = flag.String("config", "monnotify.conf", "path to the config file")
+)
+
+type (
+	Config struct {
+		DB               string `json:"db"`
+		Timeout          string `json:"timeout"`
+		Wait             string `json:"wait"`
+		Workers          int    `json:"workers"`
+		MaxAttempts      int    `json:"max_attempts"`
+		RetryInterval    string `json:"retry_interval"`
+		MaxRetryInterval string `json:"max_retry_interval"`
+	}
+)
+
+func main() {
+	flag.Parse()
+
+	raw, err := ioutil.ReadFile(*configPath)
+	if err != nil {
+		log.Fatalf("could not read config: %s", err)
+	}
+	config := Config{
+		Timeout:          "30s",
+		Wait:             "30s",
+		Workers:          5,
+		MaxAttempts:      5,
+		RetryInterval:    "1m",
+		MaxRetryInterval: "30m",
+	}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		log.Fatalf("could not parse config: %s", err)
+	}
+
+	waitDuration, err := time.ParseDuration(config.Wait)
+	if err != nil {
+		log.Fatalf("could not parse wait duration: %s", err)
+	}
+	timeout, err := time.ParseDuration(config.Timeout)
+	if err != nil {
+		log.Fatalf("could not parse timeout: %s", err)
+	}
+
+	retryInterval, err := time.ParseDuration(config.RetryInterval)
+	if err != nil {
+		log.Fatalf("could not parse retry interval: %s", err)
+	}
+	maxRetryInterval, err := time.ParseDuration(config.MaxRetryInterval)
+	if err != nil {
+		log.Fatalf("could not parse max retry interval: %s", err)
+	}
+
+	db, err := sql.Open("postgres", config.DB)
+	if err != nil {
+		log.Fatalf("could not open database connection: %s", err)
+	}
+
+	sender, err := monzero.NewSender(monzero.SenderConfig{
+		DB:               db,
+		Timeout:          timeout,
+		MaxAttempts:      config.MaxAttempts,
+		RetryInterval:    retryInterval,
+		MaxRetryInterval: maxRetryInterval,
+	})
+	if err != nil {
+		log.Fatalf("could not create sender instance: %s", err)
+	}
+
+	for i := 0; i < config.Workers; i++ {
+		go send(sender, waitDuration)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	wg.Wait()
+}
+
+func send(sender *monzero.Sender, waitDuration time.Duration) {
+	for {
+		if err := sender.Next(); err != nil {
+			if err != monzero.ErrNoNotification {
+				log.Printf("could not send notification: %s", err)
+			}
+			time.Sleep(waitDuration)
+		}
+	}
+}
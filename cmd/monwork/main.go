@@ -5,12 +5,15 @@ import (
 	"database/sql"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"sync"
 	"text/template"
 	"time"
 
+	"git.zero-knowledge.org/gibheer/monzero"
 	"github.com/lib/pq"
 )
 
@@ -22,6 +25,20 @@ type (
 	Config struct {
 		DB            string `json:"db"`
 		CheckInterval string `json:"interval"`
+		// ResultRetention and MetricRetention are the intervals, after which
+		// check results and metrics are removed, like `30 days`.
+		// They are kept forever when empty.
+		ResultRetention string `json:"result_retention"`
+		MetricRetention string `json:"metric_retention"`
+		// InstanceRetention is the interval after which dead checker
+		// instances are removed.
+		InstanceRetention string `json:"instance_retention"`
+		// StaleFactor is the factor of the interval of a check, after which
+		// a check without a new result is stale. Stale checks are forced
+		// into StaleState. Detection is disabled when set to 0, otherwise it
+		// must be at least 1.
+		StaleFactor float64 `json:"stale_factor"`
+		StaleState  int     `json:"stale_state"`
 	}
 )
 
@@ -32,7 +49,13 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not read config: %s", err)
 	}
-	config := Config{}
+	config := Config{
+		ResultRetention:   "30 days",
+		MetricRetention:   "30 days",
+		InstanceRetention: "7 days",
+		StaleFactor:       3,
+		StaleState:        3,
+	}
 	if err := json.Unmarshal(raw, &config); err != nil {
 		log.Fatalf("could not parse config: %s", err)
 	}
@@ -50,6 +73,50 @@ func main() {
 	go startNodeGen(db, checkInterval)
 	go startCommandGen(db, checkInterval)
 	go startConfigGen(db, checkInterval)
+	go startDowntimeCleanup(db, checkInterval)
+	go startAckExpiry(db, checkInterval)
+	go startEscalation(db, checkInterval)
+	if config.ResultRetention != "" {
+		go startCleanup(db, checkInterval, "check results", SQLDeleteOldResults, config.ResultRetention)
+	}
+	if config.MetricRetention != "" {
+		go startCleanup(db, checkInterval, "check metrics", SQLDeleteOldMetrics, config.MetricRetention)
+	}
+	if config.InstanceRetention != "" {
+		go startCleanup(db, checkInterval, "checker instances", SQLDeleteOldInstances, config.InstanceRetention)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("could not resolve hostname: %s", err)
+	}
+	passiveID := 0
+	if err := db.QueryRow(`select id from checkers where name = 'passive'`).Scan(&passiveID); err != nil {
+		log.Fatalf("could not find checker 'passive': %s", err)
+	}
+	passive, err := monzero.NewChecker(monzero.CheckerConfig{
+		CheckerID:      passiveID,
+		DB:             db,
+		HostIdentifier: hostname,
+	})
+	if err != nil {
+		log.Fatalf("could not create passive checker: %s", err)
+	}
+	go startLivenessCheck(db, passive, checkInterval, hostname)
+
+	if config.StaleFactor > 0 && config.StaleFactor < 1 {
+		log.Fatalf("stale_factor must be 0 or at least 1")
+	}
+	if config.StaleFactor > 0 {
+		checker, err := monzero.NewChecker(monzero.CheckerConfig{
+			DB:             db,
+			HostIdentifier: hostname,
+		})
+		if err != nil {
+			log.Fatalf("could not create checker for stale checks: %s", err)
+		}
+		go startStaleDetection(checker, checkInterval, config.StaleFactor, config.StaleState)
+	}
 
 	// don't exit, we have work to do
 	wg := sync.WaitGroup{}
@@ -184,6 +251,119 @@ func startConfigGen(db *sql.DB, checkInterval time.Duration) {
 	}
 }
 
+// startDowntimeCleanup removes all downtimes which are over or whose group
+// was removed.
+func startDowntimeCleanup(db *sql.DB, checkInterval time.Duration) {
+	for {
+		if _, err := db.Exec(SQLDeleteExpiredDowntimes); err != nil {
+			log.Printf("could not remove expired downtimes: %s", err)
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// startAckExpiry removes all acknowledgements which have expired.
+func startAckExpiry(db *sql.DB, checkInterval time.Duration) {
+	for {
+		if _, err := db.Exec(SQLExpireAcks); err != nil {
+			log.Printf("could not expire acknowledgements: %s", err)
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// startEscalation creates the notifications of all escalation steps which are
+// due, because a check is not okay and not acknowledged for long enough.
+func startEscalation(db *sql.DB, checkInterval time.Duration) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("could not resolve hostname: %s", err)
+	}
+	for {
+		if _, err := db.Exec(SQLEscalate, hostname); err != nil {
+			log.Printf("could not escalate checks: %s", err)
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// startStaleDetection forces all stale checks into the stale state.
+func startStaleDetection(checker *monzero.Checker, checkInterval time.Duration, factor float64, state int) {
+	for {
+		for {
+			if err := checker.NextStale(factor, state); err == monzero.ErrNoCheck {
+				break
+			} else if err != nil {
+				log.Printf("could not handle stale check: %s", err)
+				break
+			}
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// startLivenessCheck submits the state of the live instances of every checker
+// to its liveness check. The result is only submitted, when the state changed
+// or the liveness check is due.
+func startLivenessCheck(db *sql.DB, passive *monzero.Checker, checkInterval time.Duration, hostname string) {
+	type liveness struct {
+		checker string
+		checkID int64
+		alive   int
+		last    pq.NullTime
+	}
+	for {
+		checks := []liveness{}
+		rows, err := db.Query(SQLLiveness)
+		if err != nil {
+			log.Printf("could not get liveness of checkers: %s", err)
+			time.Sleep(checkInterval)
+			continue
+		}
+		for rows.Next() {
+			l := liveness{}
+			if err := rows.Scan(&l.checker, &l.checkID, &l.alive, &l.last); err != nil {
+				log.Printf("could not scan liveness of checkers: %s", err)
+				break
+			}
+			checks = append(checks, l)
+		}
+		rows.Close()
+
+		for _, l := range checks {
+			result := monzero.CheckResult{
+				ExitCode: 0,
+				Message:  fmt.Sprintf("%d live instances of checker '%s'", l.alive, l.checker),
+			}
+			if l.alive == 0 {
+				result.ExitCode = 2
+				result.Message = fmt.Sprintf("no instance of checker '%s' registered", l.checker)
+				if l.last.Valid {
+					result.Message = fmt.Sprintf("no live instance of checker '%s' since %s",
+						l.checker, l.last.Time.Format("2006-01-02 15:04:05 MST"))
+				}
+			}
+			if err := passive.Submit(l.checkID, result, hostname); err == monzero.ErrNoCheck {
+				log.Printf("liveness check '%d' of checker '%s' is not a passive check", l.checkID, l.checker)
+			} else if err != nil {
+				log.Printf("could not submit liveness of checker '%s': %s", l.checker, err)
+			}
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// startCleanup removes the entries older than the retention through the
+// query.
+func startCleanup(db *sql.DB, checkInterval time.Duration, name, query, retention string) {
+	for {
+		if _, err := db.Exec(query, retention); err != nil {
+			log.Printf("could not remove old %s: %s", name, err)
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
 func stringToShellFields(in []byte) [][]byte {
 	if len(in) == 0 {
 		return [][]byte{}
@@ -226,13 +406,69 @@ var (
 	where c.last_refresh < c.updated or c.last_refresh is null
   limit 1
 	for update of c skip locked;`
-	SQLRefreshActiveCheck = `insert into active_checks(check_id, cmdline, intval, enabled, msg, mapping_id, checker_id)
-select c.id, $2, c.intval, c.enabled, case when ac.msg is null then '' else ac.msg end, case when c.mapping_id is not null then c.mapping_id when n.mapping_id is not null then n.mapping_id else 1 end, c.checker_id
+	SQLRefreshActiveCheck = `insert into active_checks(check_id, cmdline, intval, enabled, msg, mapping_id, checker_id, max_attempts, retry_intval, options, timeout, timeout_exit_code, timeout_message, flap_window, flap_start, flap_stop)
+select c.id, $2, c.intval, c.enabled, case when ac.msg is null then '' else ac.msg end, case when c.mapping_id is not null then c.mapping_id when n.mapping_id is not null then n.mapping_id else 1 end, c.checker_id, c.max_attempts, c.retry_intval, c.options, c.timeout, c.timeout_exit_code, c.timeout_message, c.flap_window, c.flap_start, c.flap_stop
 from checks c
 left join active_checks ac on c.id = ac.check_id
 left join nodes n on c.node_id = n.id
 where c.id = $1
 on conflict(check_id)
-do update set cmdline = $2, intval = excluded.intval, enabled = excluded.enabled, mapping_id = excluded.mapping_id, checker_id = excluded.checker_id;`
-	SQLUpdateLastRefresh = `update checks set last_refresh = now() where id = $1;`
+do update set cmdline = $2, intval = excluded.intval, enabled = excluded.enabled, mapping_id = excluded.mapping_id, checker_id = excluded.checker_id, max_attempts = excluded.max_attempts, retry_intval = excluded.retry_intval, options = excluded.options, timeout = excluded.timeout, timeout_exit_code = excluded.timeout_exit_code, timeout_message = excluded.timeout_message, flap_window = excluded.flap_window, flap_start = excluded.flap_start, flap_stop = excluded.flap_stop;`
+	SQLUpdateLastRefresh      = `update checks set last_refresh = now() where id = $1;`
+	SQLDeleteExpiredDowntimes = `delete from downtimes where ends < now() or group_id not in (select id from groups);`
+	SQLExpireAcks             = `update active_checks
+	set acknowledged = false, ack_author = null, ack_comment = null,
+		ack_time = null, ack_expires = null, ack_sticky = false
+	where acknowledged and ack_expires < now();`
+	SQLDeleteOldResults   = `delete from check_results where time < now() - $1::interval;`
+	SQLDeleteOldMetrics   = `delete from check_metrics where time < now() - $1::interval;`
+	SQLDeleteOldInstances = `delete from checker_instances where heartbeat < now() - $1::interval;`
+	// SQLLiveness returns the number of live instances of all checkers with
+	// a liveness check, when the state changed or the check is due. An
+	// instance is dead after missing three heartbeats.
+	SQLLiveness = `select c.name, c.liveness_check_id,
+		count(i.id) filter (where i.alive),
+		max(i.heartbeat)
+	from checkers c
+	join active_checks ac on c.liveness_check_id = ac.check_id
+	left join checker_instances_alive i on c.id = i.checker_id
+	where ac.enabled
+	group by c.name, c.liveness_check_id, ac.next_time, ac.states[1]
+	having ac.next_time < now()
+		or ac.states[1] is distinct from
+			case when count(i.id) filter (where i.alive) > 0
+				then 0 else 2 end;`
+	// SQLEscalate creates a notification for every escalation step which is
+	// due and remembers the last escalated step in the active check.
+	// Checks which are flapping, muted or in a downtime are not escalated.
+	// The delay of a step starts, when the mapped hard state changed.
+	SQLEscalate = `with due as (
+	select ac.check_id, ac.mapping_id, ac.states, ac.msg, es.step, es.notifier_id
+	from active_checks ac
+	join checks c on ac.check_id = c.id
+	join escalation_steps es on c.escalation_policy_id = es.policy_id
+	join mapping_level ml on ac.mapping_id = ml.mapping_id and ac.hard_state = ml.source
+	where ac.enabled
+		and ml.target != 0
+		and not ac.acknowledged
+		and not ac.flapping
+		and es.step > ac.escalation_step
+		and ac.hard_since + es.delay <= now()
+		and not check_in_downtime(c.id)
+		and not exists(select 1 from checks_notify cn where cn.check_id = ac.check_id and not cn.enabled)
+	for update of ac skip locked
+), escalated as (
+	insert into notifications(check_id, states, output, mapping_id, notifier_id, check_host, escalation_step)
+	select d.check_id,
+		coalesce((select array_agg(ml.target order by s.idx)
+			from unnest(d.states) with ordinality s(state, idx)
+			join mapping_level ml on d.mapping_id = ml.mapping_id and s.state = ml.source), d.states),
+		'escalation step ' || d.step || ': ' || d.msg, d.mapping_id, d.notifier_id, $1, d.step
+	from due d
+	returning check_id, escalation_step
+)
+update active_checks ac
+set escalation_step = e.step
+from (select check_id, max(escalation_step) step from escalated group by check_id) e
+where ac.check_id = e.check_id;`
 )
@@ -0,0 +1,118 @@
+package monzero
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DigestUngrouped is the group of notifications of nodes without a group.
+const DigestUngrouped = "ungrouped"
+
+type (
+	// Digest contains all notifications of a notifier created in its batch
+	// window, which are delivered together.
+	Digest struct {
+		ID            int64
+		NotifierID    int
+		NotifierName  string
+		Notifications []Notification
+	}
+
+	// DigestNotifier is implemented by notifiers which can deliver a digest
+	// in one message. Other notifiers get the summary of the digest.
+	DigestNotifier interface {
+		Notifier
+		// NotifyDigest must deliver the digest in the time of the context.
+		NotifyDigest(Digest, context.Context) (NotifyResult, error)
+	}
+
+	// DigestPayload is the JSON document describing a digest.
+	DigestPayload struct {
+		ID            int64                 `json:"id"`
+		Notifier      string                `json:"notifier"`
+		Notifications []NotificationPayload `json:"notifications"`
+		// Groups maps the group names to the notifications of their nodes.
+		Groups map[string][]NotificationPayload `json:"groups"`
+	}
+)
+
+// Groups returns the notifications grouped by the groups of their nodes.
+// A notification of a node in multiple groups is part of every group.
+func (d Digest) Groups() map[string][]Notification {
+	groups := map[string][]Notification{}
+	for _, n := range d.Notifications {
+		if len(n.Groups) == 0 {
+			groups[DigestUngrouped] = append(groups[DigestUngrouped], n)
+		}
+		for _, group := range n.Groups {
+			groups[group] = append(groups[group], n)
+		}
+	}
+	return groups
+}
+
+// Notification returns the summary of the digest as a single notification
+// for notifiers which can not deliver a digest.
+func (d Digest) Notification() Notification {
+	nodes := map[string]bool{}
+	for _, n := range d.Notifications {
+		nodes[n.NodeName] = true
+	}
+	summary := Notification{
+		CheckName:    fmt.Sprintf("%d checks", len(d.Notifications)),
+		NodeName:     fmt.Sprintf("%d nodes", len(nodes)),
+		CommandName:  "digest",
+		StateTitle:   "digest",
+		Output:       d.String(),
+		NotifierID:   d.NotifierID,
+		NotifierName: d.NotifierName,
+	}
+	if len(d.Notifications) > 0 {
+		first := d.Notifications[0]
+		summary.Inserted = first.Inserted
+		summary.CheckHost = first.CheckHost
+		summary.NotifierSettings = first.NotifierSettings
+	}
+	return summary
+}
+
+// String lists the notifications of the digest by group.
+func (d Digest) String() string {
+	groups := d.Groups()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%d notifications\n", len(d.Notifications))
+	for _, name := range names {
+		fmt.Fprintf(b, "\n%s:\n", name)
+		for _, n := range groups[name] {
+			fmt.Fprintf(b, "  %s %s [%s]: %s\n", n.NodeName, n.CheckName, n.StateTitle, n.Output)
+		}
+	}
+	return b.String()
+}
+
+// Payload returns the document describing the digest.
+func (d Digest) Payload() DigestPayload {
+	p := DigestPayload{
+		ID:            d.ID,
+		Notifier:      d.NotifierName,
+		Notifications: []NotificationPayload{},
+		Groups:        map[string][]NotificationPayload{},
+	}
+	for _, n := range d.Notifications {
+		p.Notifications = append(p.Notifications, n.Payload())
+	}
+	for name, notifications := range d.Groups() {
+		for _, n := range notifications {
+			p.Groups[name] = append(p.Groups[name], n.Payload())
+		}
+	}
+	return p
+}
@@ -0,0 +1,39 @@
+package monzero
+
+import (
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	d := Digest{Notifications: []Notification{
+		{NodeName: "sw1", CheckName: "ping", StateTitle: "critical", Output: "unreachable", Groups: []string{"switches", "core"}},
+		{NodeName: "web1", CheckName: "http", StateTitle: "critical", Output: "timeout"},
+		{NodeName: "sw2", CheckName: "ping", StateTitle: "warning", Output: "packet loss", Groups: []string{"switches"}},
+	}}
+	groups := d.Groups()
+	for name, count := range map[string]int{"switches": 2, "core": 1, DigestUngrouped: 1} {
+		if len(groups[name]) != count {
+			t.Errorf("expected %d notifications in group %s, got %d", count, name, len(groups[name]))
+		}
+	}
+
+	expected := `3 notifications
+
+core:
+  sw1 ping [critical]: unreachable
+
+switches:
+  sw1 ping [critical]: unreachable
+  sw2 ping [warning]: packet loss
+
+ungrouped:
+  web1 http [critical]: timeout
+`
+	if result := d.String(); result != expected {
+		t.Errorf("unexpected digest text:\n%s", result)
+	}
+	summary := d.Notification()
+	if summary.CheckName != "3 checks" || summary.NodeName != "3 nodes" || summary.Output != expected {
+		t.Errorf("unexpected summary %#v", summary)
+	}
+}
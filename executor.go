@@ -8,8 +8,53 @@ import (
 	"syscall"
 )
 
+type (
+	// Executor runs a check in the time of the context and returns its
+	// result.
+	Executor func(Check, context.Context) CheckResult
+
+	// Executors maps the name of a checker to the executor running its
+	// checks.
+	Executors map[string]Executor
+)
+
+var (
+	// DefaultExecutors contains the executors for all checkers shipped with
+	// monzero. Register additional executors here.
+	DefaultExecutors = Executors{
+		"moncheck": CheckExec,
+		"http":     CheckHTTP,
+		"tcp":      CheckTCP,
+		"dns":      CheckDNS,
+	}
+)
+
+// Register adds a new executor for the checker name. An existing executor
+// with the same name is replaced.
+func (e Executors) Register(name string, executor Executor) {
+	e[name] = executor
+}
+
+// Get returns the executor for the checker name.
+func (e Executors) Get(name string) (Executor, error) {
+	executor, found := e[name]
+	if !found {
+		return nil, fmt.Errorf("no executor for checker '%s' registered", name)
+	}
+	return executor, nil
+}
+
+// The states returned by the executors of monzero.
+const (
+	stateOkay     = 0
+	stateWarning  = 1
+	stateCritical = 2
+	stateUnknown  = 3
+)
+
 // CheckExec runs a command line string.
-// The output is recorded completely and returned as one message.
+// The output is returned as the message. Performance data in the output is
+// parsed and removed from the message.
 func CheckExec(check Check, ctx context.Context) CheckResult {
 	result := CheckResult{}
 
@@ -20,19 +65,19 @@ func CheckExec(check Check, ctx context.Context) CheckResult {
 	err := cmd.Run()
 	if err != nil {
 		if cmd.ProcessState == nil {
-			result.Message = fmt.Sprintf("unknown error when running command: %w", err)
+			result.Message = fmt.Sprintf("unknown error when running command: %s", err)
 			result.ExitCode = 3
 			return result
 		}
 
 		status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
 		if !ok {
-			result.Message = fmt.Sprintf("error running check: %w", err)
+			result.Message = fmt.Sprintf("error running check: %s", err)
 			result.ExitCode = 2
 		} else {
 			result.ExitCode = status.ExitStatus()
 		}
 	}
-	result.Message = output.String()
+	result.Message, result.PerfData = ParsePerfData(output.String())
 	return result
 }
@@ -0,0 +1,171 @@
+package monzero
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// DNSCheckOptions are the options of a check run by CheckDNS.
+	DNSCheckOptions struct {
+		// Name is the name to resolve.
+		Name string `json:"name"`
+		// Type is the record type, one of A, AAAA, CNAME, MX, TXT or SRV.
+		Type string `json:"type"`
+		// Server is the address of the resolver to query. The port defaults
+		// to 53. When not set, the resolver of the system is used.
+		Server string `json:"server"`
+		// Expect contains the answers which must be returned.
+		Expect []string `json:"expect"`
+		// Match is a regular expression all answers must match.
+		Match string `json:"match"`
+	}
+)
+
+var (
+	errUnknownRecordType = fmt.Errorf("unknown record type")
+)
+
+// CheckDNS resolves the name in the options of the check.
+// The check is critical, when the name does not exist, the resolver failed
+// or timed out, or the answers are not the expected ones.
+//
+// The answers are compared in the following format:
+//   - A and AAAA: the address
+//   - CNAME: the canonical name with a trailing dot
+//   - MX: the preference and host, like `10 mx.example.com.`
+//   - TXT: the text
+//   - SRV: the priority, weight, port and target, like
+//     `10 5 5060 sip.example.com.`
+func CheckDNS(check Check, ctx context.Context) CheckResult {
+	opts := DNSCheckOptions{Type: "A"}
+	if err := json.Unmarshal(check.Options, &opts); err != nil {
+		return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse options: %s", err)}
+	}
+	if opts.Name == "" {
+		return CheckResult{ExitCode: stateUnknown, Message: "option name must be set"}
+	}
+	var match *regexp.Regexp
+	if opts.Match != "" {
+		var err error
+		if match, err = regexp.Compile(opts.Match); err != nil {
+			return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse match: %s", err)}
+		}
+	}
+
+	resolver := net.DefaultResolver
+	if opts.Server != "" {
+		server := opts.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	answers, err := dnsLookup(ctx, resolver, strings.ToUpper(opts.Type), opts.Name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			switch {
+			case dnsErr.IsNotFound:
+				return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("NXDOMAIN: %s", err)}
+			case dnsErr.IsTimeout:
+				return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("timeout: %s", err)}
+			// The resolver has no flag for SERVFAIL and only reports the
+			// message "server misbehaving", which it also uses for malformed
+			// answers. Both end up as SERVFAIL.
+			case dnsErr.Err == "server misbehaving":
+				return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("SERVFAIL: %s", err)}
+			}
+		}
+		if errors.Is(err, errUnknownRecordType) {
+			return CheckResult{ExitCode: stateUnknown, Message: err.Error()}
+		}
+		return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("lookup failed: %s", err)}
+	}
+	sort.Strings(answers)
+	message := fmt.Sprintf("%s %s: %s", opts.Type, opts.Name, strings.Join(answers, ", "))
+
+	for _, expected := range opts.Expect {
+		found := false
+		for _, answer := range answers {
+			if answer == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return CheckResult{ExitCode: stateCritical, Message: message + fmt.Sprintf(", expected '%s' is missing", expected)}
+		}
+	}
+	if match != nil {
+		for _, answer := range answers {
+			if !match.MatchString(answer) {
+				return CheckResult{ExitCode: stateCritical, Message: message + fmt.Sprintf(", '%s' does not match '%s'", answer, opts.Match)}
+			}
+		}
+	}
+	return CheckResult{ExitCode: stateOkay, Message: message}
+}
+
+// dnsLookup resolves the name and returns the answers for the record type.
+func dnsLookup(ctx context.Context, resolver *net.Resolver, recordType, name string) ([]string, error) {
+	answers := []string{}
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "TXT":
+		txts, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, txts...)
+	case "SRV":
+		_, srvs, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target))
+		}
+	default:
+		return nil, fmt.Errorf("%w '%s'", errUnknownRecordType, recordType)
+	}
+	return answers, nil
+}
@@ -0,0 +1,178 @@
+package monzero
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeMX    = 15
+	dnsTypeTXT   = 16
+	dnsTypeAAAA  = 28
+	dnsTypeSRV   = 33
+)
+
+type (
+	// dnsRecord is a record served by dnsServer with the encoded data.
+	dnsRecord struct {
+		rtype uint16
+		data  []byte
+	}
+
+	// dnsServer answers DNS queries over UDP from a static set of records.
+	dnsServer struct {
+		conn    net.PacketConn
+		records map[string][]dnsRecord
+		// rcodes contains names which are answered with a response code.
+		rcodes map[string]byte
+		// silent contains names which are never answered.
+		silent map[string]bool
+	}
+)
+
+func dnsName(name string) []byte {
+	result := []byte{}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		result = append(result, byte(len(label)))
+		result = append(result, label...)
+	}
+	return append(result, 0)
+}
+
+func dnsUint16(vals ...uint16) []byte {
+	result := []byte{}
+	for _, val := range vals {
+		result = append(result, byte(val>>8), byte(val))
+	}
+	return result
+}
+
+func (s *dnsServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if response := s.answer(buf[:n]); response != nil {
+			s.conn.WriteTo(response, addr)
+		}
+	}
+}
+
+// answer builds the response to a query with a single question.
+func (s *dnsServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// read the question name
+	pos := 12
+	labels := []string{}
+	for pos < len(query) && query[pos] != 0 {
+		length := int(query[pos])
+		if pos+1+length > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[pos+1:pos+1+length]))
+		pos += 1 + length
+	}
+	if pos+5 > len(query) {
+		return nil
+	}
+	question := query[12 : pos+5]
+	qtype := binary.BigEndian.Uint16(query[pos+1 : pos+3])
+	name := strings.ToLower(strings.Join(labels, ".")) + "."
+	if s.silent[name] {
+		return nil
+	}
+
+	rcode, found := s.rcodes[name]
+	answers := []dnsRecord{}
+	if _, exists := s.records[name]; !exists && !found {
+		rcode = 3 // NXDOMAIN
+	}
+	for _, record := range s.records[name] {
+		if record.rtype == qtype || record.rtype == dnsTypeCNAME {
+			answers = append(answers, record)
+		}
+	}
+
+	response := append([]byte{}, query[0:2]...)
+	response = append(response, 0x84|query[2]&0x01, 0x80|rcode)
+	response = append(response, dnsUint16(1, uint16(len(answers)), 0, 0)...)
+	response = append(response, question...)
+	for _, record := range answers {
+		// the name points to the question
+		response = append(response, dnsUint16(0xc00c, record.rtype, 1)...)
+		response = append(response, 0, 0, 0, 60)
+		response = append(response, dnsUint16(uint16(len(record.data)))...)
+		response = append(response, record.data...)
+	}
+	return response
+}
+
+func TestCheckDNS(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start dns server: %s", err)
+	}
+	defer conn.Close()
+	server := &dnsServer{
+		conn: conn,
+		records: map[string][]dnsRecord{
+			"host.monzero.test.": {
+				{dnsTypeA, []byte{192, 0, 2, 1}},
+				{dnsTypeA, []byte{192, 0, 2, 2}},
+				{dnsTypeAAAA, net.ParseIP("2001:db8::1")},
+				{dnsTypeMX, append(dnsUint16(10), dnsName("mx.monzero.test.")...)},
+				{dnsTypeTXT, append([]byte{11}, "v=spf1 -all"...)},
+			},
+			"www.monzero.test.": {
+				{dnsTypeCNAME, dnsName("host.monzero.test.")},
+			},
+			"_sip._udp.monzero.test.": {
+				{dnsTypeSRV, append(dnsUint16(10, 5, 5060), dnsName("sip.monzero.test.")...)},
+			},
+		},
+		rcodes: map[string]byte{"broken.monzero.test.": 2},
+		silent: map[string]bool{"silent.monzero.test.": true},
+	}
+	go server.serve()
+
+	type S struct {
+		options  string
+		exitCode int
+		message  string
+	}
+	for i, e := range []S{
+		S{`{"name": "host.monzero.test.", "expect": ["192.0.2.1", "192.0.2.2"]}`, stateOkay, ""},
+		S{`{"name": "host.monzero.test.", "expect": ["192.0.2.3"]}`, stateCritical, "missing"},
+		S{`{"name": "host.monzero.test.", "match": "^192\\.0\\.2\\.1$"}`, stateCritical, "does not match"},
+		S{`{"name": "host.monzero.test.", "type": "AAAA", "expect": ["2001:db8::1"]}`, stateOkay, ""},
+		S{`{"name": "www.monzero.test.", "type": "CNAME", "expect": ["host.monzero.test."]}`, stateOkay, ""},
+		S{`{"name": "host.monzero.test.", "type": "MX", "expect": ["10 mx.monzero.test."]}`, stateOkay, ""},
+		S{`{"name": "host.monzero.test.", "type": "txt", "match": "^v=spf1 "}`, stateOkay, ""},
+		S{`{"name": "_sip._udp.monzero.test.", "type": "SRV", "expect": ["10 5 5060 sip.monzero.test."]}`, stateOkay, ""},
+		S{`{"name": "missing.monzero.test."}`, stateCritical, "NXDOMAIN"},
+		S{`{"name": "broken.monzero.test."}`, stateCritical, "SERVFAIL"},
+		S{`{"name": "silent.monzero.test."}`, stateCritical, "timeout"},
+		S{`{"name": "host.monzero.test.", "type": "NS"}`, stateUnknown, ""},
+		S{`{"type": "A"}`, stateUnknown, ""},
+	} {
+		options := strings.Replace(e.options, "{", fmt.Sprintf(`{"server": "%s", `, conn.LocalAddr()), 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		result := CheckDNS(Check{Options: []byte(options)}, ctx)
+		cancel()
+		if result.ExitCode != e.exitCode || !strings.Contains(result.Message, e.message) {
+			t.Errorf("test %d: expected exit code %d with %q, got %d: %s",
+				i, e.exitCode, e.message, result.ExitCode, result.Message)
+		}
+	}
+}
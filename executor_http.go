@@ -0,0 +1,154 @@
+package monzero
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// HTTPCheckOptions are the options of a check run by CheckHTTP.
+	HTTPCheckOptions struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body"`
+		// Status contains the expected status codes. When empty, all codes
+		// below 400 are okay.
+		Status []int `json:"status"`
+		// Match is a regular expression the response body must match.
+		Match              string `json:"match"`
+		InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+		ServerName         string `json:"server_name"`
+		// Redirects is the number of redirects to follow.
+		Redirects int `json:"redirects"`
+		// Warn and Crit are the response times after which the check is in
+		// a warning or critical state.
+		Warn string `json:"warn"`
+		Crit string `json:"crit"`
+	}
+)
+
+const (
+	// httpMaxBody is the size of the response body read for matching.
+	httpMaxBody = 1 << 20
+)
+
+// CheckHTTP runs a HTTP request configured through the options of the check.
+// The check is critical, when the request fails, the status code is not
+// expected or the body does not match. It is warning or critical, when the
+// response took longer than the configured thresholds.
+func CheckHTTP(check Check, ctx context.Context) CheckResult {
+	opts := HTTPCheckOptions{
+		Method:    "GET",
+		Redirects: 10,
+	}
+	if err := json.Unmarshal(check.Options, &opts); err != nil {
+		return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse options: %s", err)}
+	}
+	if opts.URL == "" {
+		return CheckResult{ExitCode: stateUnknown, Message: "option url must be set"}
+	}
+	var (
+		match      *regexp.Regexp
+		warn, crit time.Duration
+		err        error
+	)
+	if opts.Match != "" {
+		if match, err = regexp.Compile(opts.Match); err != nil {
+			return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse match: %s", err)}
+		}
+	}
+	if opts.Warn != "" {
+		if warn, err = time.ParseDuration(opts.Warn); err != nil {
+			return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse warn: %s", err)}
+		}
+	}
+	if opts.Crit != "" {
+		if crit, err = time.ParseDuration(opts.Crit); err != nil {
+			return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse crit: %s", err)}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, opts.Method, opts.URL, strings.NewReader(opts.Body))
+	if err != nil {
+		return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not create request: %s", err)}
+	}
+	for key, val := range opts.Headers {
+		req.Header.Set(key, val)
+	}
+	if host, found := opts.Headers["Host"]; found {
+		req.Host = host
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+				ServerName:         opts.ServerName,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.Redirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("request failed: %s", err)}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, httpMaxBody))
+	took := time.Since(start)
+	if err != nil {
+		return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("could not read response: %s", err)}
+	}
+
+	message := fmt.Sprintf("%s %s returned %s in %s", opts.Method, opts.URL, resp.Status, took.Round(time.Millisecond))
+	if !httpStatusExpected(resp.StatusCode, opts.Status) {
+		return CheckResult{ExitCode: stateCritical, Message: message + ", status is not expected"}
+	}
+	if match != nil && !match.Match(body) {
+		return CheckResult{ExitCode: stateCritical, Message: message + fmt.Sprintf(", body does not match '%s'", opts.Match)}
+	}
+	perfData := []PerfData{{Label: "time", Value: took.Seconds(), Unit: "s"}}
+	if warn > 0 {
+		perfData[0].Warn = strconv.FormatFloat(warn.Seconds(), 'f', -1, 64)
+	}
+	if crit > 0 {
+		perfData[0].Crit = strconv.FormatFloat(crit.Seconds(), 'f', -1, 64)
+	}
+	if crit > 0 && took > crit {
+		return CheckResult{ExitCode: stateCritical, Message: message + fmt.Sprintf(", slower than %s", crit), PerfData: perfData}
+	}
+	if warn > 0 && took > warn {
+		return CheckResult{ExitCode: stateWarning, Message: message + fmt.Sprintf(", slower than %s", warn), PerfData: perfData}
+	}
+	return CheckResult{ExitCode: stateOkay, Message: message, PerfData: perfData}
+}
+
+// httpStatusExpected returns true, when the code is one of the expected codes.
+func httpStatusExpected(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code < 400
+	}
+	for _, e := range expected {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
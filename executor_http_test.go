@@ -0,0 +1,63 @@
+package monzero
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckHTTP(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintf(w, "slow")
+		case "/":
+			if r.Header.Get("X-Token") != "secret" {
+				w.WriteHeader(http.StatusForbidden)
+			}
+			fmt.Fprintf(w, "hello %s", r.Method)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	type S struct {
+		options  string
+		exitCode int
+	}
+	for i, e := range []S{
+		S{`{"url": "%s/", "insecure_skip_verify": true, "headers": {"X-Token": "secret"}}`, stateOkay},
+		S{`{"url": "%s/", "insecure_skip_verify": true}`, stateCritical},
+		S{`{"url": "%s/", "insecure_skip_verify": true, "status": [403]}`, stateOkay},
+		S{`{"url": "%s/", "headers": {"X-Token": "secret"}}`, stateCritical},
+		S{`{"url": "%s/", "insecure_skip_verify": true, "headers": {"X-Token": "secret"}, "match": "^hello GET$"}`, stateOkay},
+		S{`{"url": "%s/", "insecure_skip_verify": true, "headers": {"X-Token": "secret"}, "method": "HEAD", "match": "hello"}`, stateCritical},
+		S{`{"url": "%s/missing", "insecure_skip_verify": true}`, stateCritical},
+		S{`{"url": "%s/redirect", "insecure_skip_verify": true, "status": [403]}`, stateOkay},
+		S{`{"url": "%s/redirect", "insecure_skip_verify": true, "redirects": 0, "status": [302]}`, stateOkay},
+		S{`{"url": "%s/slow", "insecure_skip_verify": true, "warn": "10ms"}`, stateWarning},
+		S{`{"url": "%s/slow", "insecure_skip_verify": true, "warn": "10ms", "crit": "20ms"}`, stateCritical},
+		S{`{"url": "%s/slow", "insecure_skip_verify": true, "warn": "5s", "crit": "10s"}`, stateOkay},
+		S{`{"url": "%s/", "match": "("}`, stateUnknown},
+		S{`{"method": "GET"}`, stateUnknown},
+	} {
+		options := e.options
+		if strings.Contains(options, "%s") {
+			options = fmt.Sprintf(options, server.URL)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		result := CheckHTTP(Check{Options: []byte(options)}, ctx)
+		cancel()
+		if result.ExitCode != e.exitCode {
+			t.Errorf("test %d: expected exit code %d, got %d: %s", i, e.exitCode, result.ExitCode, result.Message)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package monzero
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+type (
+	// TCPCheckOptions are the options of a check run by CheckTCP.
+	TCPCheckOptions struct {
+		// Address is the host and port to connect to.
+		Address string `json:"address"`
+		// TLS enables the TLS handshake after the connection was established.
+		TLS bool `json:"tls"`
+		// ServerName is sent through SNI and used to verify the certificate.
+		// It defaults to the host of the address.
+		ServerName string `json:"server_name"`
+		// CAFile is the path to the PEM encoded certificates to verify the
+		// certificate chain. The system roots are used when not set.
+		CAFile             string `json:"ca_file"`
+		InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+		// MinVersion is the minimal TLS version the server must negotiate,
+		// like 1.2.
+		MinVersion string `json:"min_version"`
+		// WarnDays and CritDays are the days before the expiry of the
+		// certificate chain, at which the check is warning or critical.
+		WarnDays int `json:"warn_days"`
+		CritDays int `json:"crit_days"`
+	}
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// tlsVersionName returns the name of the TLS version.
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return "TLS " + name
+		}
+	}
+	return fmt.Sprintf("TLS 0x%04x", version)
+}
+
+// CheckTCP connects to the address in the options of the check and
+// optionally runs a TLS handshake.
+// The check is critical, when the connection or handshake fails, the
+// certificate chain is not valid or a lower TLS version than the minimum
+// version was negotiated. It is warning or critical, when the certificate
+// chain expires in less than the configured number of days.
+func CheckTCP(check Check, ctx context.Context) CheckResult {
+	opts := TCPCheckOptions{
+		TLS:      true,
+		WarnDays: 30,
+		CritDays: 7,
+	}
+	if err := json.Unmarshal(check.Options, &opts); err != nil {
+		return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse options: %s", err)}
+	}
+	host, _, err := net.SplitHostPort(opts.Address)
+	if err != nil {
+		return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not parse address: %s", err)}
+	}
+	if opts.ServerName == "" {
+		opts.ServerName = host
+	}
+	minVersion := uint16(0)
+	if opts.MinVersion != "" {
+		var found bool
+		if minVersion, found = tlsVersions[opts.MinVersion]; !found {
+			return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("unknown min version '%s'", opts.MinVersion)}
+		}
+	}
+	var roots *x509.CertPool
+	if opts.CAFile != "" {
+		raw, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return CheckResult{ExitCode: stateUnknown, Message: fmt.Sprintf("could not read ca file: %s", err)}
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(raw) {
+			return CheckResult{ExitCode: stateUnknown, Message: "ca file contains no certificates"}
+		}
+	}
+
+	start := time.Now()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Address)
+	if err != nil {
+		return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("could not connect: %s", err)}
+	}
+	defer conn.Close()
+	if !opts.TLS {
+		return CheckResult{ExitCode: stateOkay, Message: fmt.Sprintf("connected to %s in %s",
+			opts.Address, time.Since(start).Round(time.Millisecond))}
+	}
+
+	// The chain is verified after the handshake, to report the details of
+	// invalid certificates.
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return CheckResult{ExitCode: stateCritical, Message: fmt.Sprintf("tls handshake failed: %s", err)}
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return CheckResult{ExitCode: stateCritical, Message: "server sent no certificate"}
+	}
+	leaf := state.PeerCertificates[0]
+	message := fmt.Sprintf("%s to %s, certificate '%s'", tlsVersionName(state.Version),
+		opts.Address, leaf.Subject.CommonName)
+
+	if minVersion > 0 && state.Version < minVersion {
+		return CheckResult{ExitCode: stateCritical, Message: message +
+			fmt.Sprintf(", version is lower than %s", tlsVersionName(minVersion))}
+	}
+
+	chain := state.PeerCertificates
+	if !opts.InsecureSkipVerify {
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		chains, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       opts.ServerName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return CheckResult{ExitCode: stateCritical, Message: message + fmt.Sprintf(", chain is not valid: %s", err)}
+		}
+		chain = chains[0]
+	}
+
+	expires := chain[0].NotAfter
+	for _, cert := range chain[1:] {
+		if cert.NotAfter.Before(expires) {
+			expires = cert.NotAfter
+		}
+	}
+	days := int(time.Until(expires).Hours() / 24)
+	message += fmt.Sprintf(", expires in %d days on %s", days, expires.Format("2006-01-02"))
+	if days < opts.CritDays {
+		return CheckResult{ExitCode: stateCritical, Message: message}
+	}
+	if days < opts.WarnDays {
+		return CheckResult{ExitCode: stateWarning, Message: message}
+	}
+	return CheckResult{ExitCode: stateOkay, Message: message}
+}
@@ -0,0 +1,68 @@
+package monzero
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckTCP(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+	oldServer := httptest.NewUnstartedServer(handler)
+	oldServer.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	oldServer.StartTLS()
+	defer oldServer.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatalf("could not write ca file: %s", err)
+	}
+
+	// a port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start listener: %s", err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	addr := server.Listener.Addr().String()
+	oldAddr := oldServer.Listener.Addr().String()
+	type S struct {
+		options  string
+		exitCode int
+	}
+	for i, e := range []S{
+		S{fmt.Sprintf(`{"address": "%s", "tls": false}`, addr), stateOkay},
+		S{fmt.Sprintf(`{"address": "%s", "tls": false}`, closed), stateCritical},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s"}`, addr, caFile), stateOkay},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s", "server_name": "example.com"}`, addr, caFile), stateOkay},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s", "server_name": "monzero.invalid"}`, addr, caFile), stateCritical},
+		S{fmt.Sprintf(`{"address": "%s"}`, addr), stateCritical},
+		S{fmt.Sprintf(`{"address": "%s", "insecure_skip_verify": true}`, addr), stateOkay},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s", "warn_days": 100000}`, addr, caFile), stateWarning},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s", "warn_days": 100000, "crit_days": 100000}`, addr, caFile), stateCritical},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s", "min_version": "1.2"}`, oldAddr, caFile), stateOkay},
+		S{fmt.Sprintf(`{"address": "%s", "ca_file": "%s", "min_version": "1.3"}`, oldAddr, caFile), stateCritical},
+		S{fmt.Sprintf(`{"address": "%s", "min_version": "2.0"}`, addr), stateUnknown},
+		S{`{"address": "localhost"}`, stateUnknown},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		result := CheckTCP(Check{Options: []byte(e.options)}, ctx)
+		cancel()
+		if result.ExitCode != e.exitCode {
+			t.Errorf("test %d: expected exit code %d, got %d: %s", i, e.exitCode, result.ExitCode, result.Message)
+		}
+	}
+}
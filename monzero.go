@@ -5,18 +5,38 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 var (
 	ErrNoCheck = fmt.Errorf("no check found to run")
 )
 
+const (
+	// sqlSelectCheck loads a check with its current state. The conditions
+	// to select the check are appended.
+	sqlSelectCheck = `select check_id, cmdLine, states, mapping_id, hard_state, attempt, max_attempts,
+			history, flapping, ack_sticky, coalesce(ack_expires < now(), false), options,
+			slow_runs, extract(epoch from timeout), timeout_exit_code, timeout_message,
+			flap_window, flap_start, flap_stop
+		from active_checks`
+
+	// A run is slow, when it took more than slowRatio of the timeout. Every
+	// slow run increases the slow runs of a check and every other run
+	// decreases them, up to maxSlowRuns. A check with at least slowRunsWarn
+	// slow runs regularly uses most of its timeout.
+	slowRatio    = 0.8
+	slowRunsWarn = 5
+	maxSlowRuns  = 10
+)
+
 type (
 	// Checker maintains the state of checks that need to be run.
 	Checker struct {
 		db       *sql.DB
 		id       int // id is the resolved checker id for this instance.
-		executor func(Check, context.Context) CheckResult
+		executor Executor
 		timeout  time.Duration
 		ident    string // the host identifier
 	}
@@ -31,13 +51,17 @@ type (
 
 		// Timeout is the duration a check has time to run.
 		// Set this to a reasonable value for all checks to avoid long running
-		// checks blocking the execution.
+		// checks blocking the execution. The timeout of a check overrides
+		// this value.
 		Timeout time.Duration
 
 		// Executor receives a check and must run the requested command in the
 		// time of the context.
 		// At the end it must return a CheckResult.
-		Executor func(Check, context.Context) CheckResult
+		// DefaultExecutors contains the executors of the shipped checkers.
+		// It may be nil for checkers which only receive results through
+		// Submit, like passive checks.
+		Executor Executor
 
 		// HostIdentifier is used in notifications to point to the source of the
 		// notification.
@@ -50,9 +74,29 @@ type (
 		Command []string
 		// ExitCodes contains the list of exit codes of past runs.
 		ExitCodes []int
+		// ID is the id of the check.
+		ID int64
+		// MappingID is the id of the mapping of the exit codes.
+		MappingID int
+		// Options contains the raw options of the check as JSON.
+		Options []byte
+
+		hardState   int   // the last hard state of the check
+		attempt     int   // number of consecutive results other than okay
+		maxAttempts int   // attempts until a state becomes a hard state
+		history     []int // exit codes used for flap detection
+		flapping    bool  // is the check flapping
+		ackSticky   bool  // does the acknowledgement survive state changes
+		ackExpired  bool  // has the acknowledgement expired
+		slowRuns    int   // number of recent runs close to the timeout
 
-		id        int64 // the check instance id
-		mappingId int   // ID to map the result for this check
+		timeout         time.Duration  // timeout of the check, when set
+		timeoutExitCode sql.NullInt64  // exit code of a run hitting the timeout
+		timeoutMessage  sql.NullString // message of a run hitting the timeout
+
+		flapWindow int     // number of results to detect flapping
+		flapStart  float64 // flap ratio to start flapping
+		flapStop   float64 // flap ratio to stop flapping
 	}
 
 	// CheckResult is the result of a check. It may contain a message
@@ -67,41 +111,42 @@ type (
 	CheckResult struct {
 		ExitCode int
 		Message  string // Message will be shown in the frontend for context
+		// PerfData contains the performance data of the check, which is
+		// stored in check_metrics.
+		PerfData []PerfData
 	}
 )
 
 func NewChecker(cfg CheckerConfig) (*Checker, error) {
 	c := &Checker{db: cfg.DB,
+		id:       cfg.CheckerID,
 		executor: cfg.Executor,
 		timeout:  cfg.Timeout,
 		ident:    cfg.HostIdentifier,
 	}
-	if c.executor == nil {
-		return nil, fmt.Errorf("executor must not be nil")
-	}
 
 	return c, nil
 }
 
 // Next pulls the next check in line and runs the set executor.
-// The result is then updated in the database and a notification generated.
+// The result is then updated in the database and a notification generated,
+// when the mapped hard state changed.
 func (c *Checker) Next() error {
-	check := Check{}
+	if c.executor == nil {
+		return fmt.Errorf("checker has no executor to run checks")
+	}
 	tx, err := c.db.Begin()
 	if err != nil {
 		return fmt.Errorf("could not start database transaction: %w", err)
 	}
 	defer tx.Rollback()
-	err = tx.
-		QueryRow(`select check_id, cmdLine, states, mapping_id
-			from active_checks
-			where next_time < now()
-				and enabled
-				and checker_id = $1
-			order by next_time
-			for update skip locked
-			limit 1;`, c.id).
-		Scan(&check.id, &check.Command, &check.ExitCodes, &check.mappingId)
+	check, err := scanCheck(tx.QueryRow(sqlSelectCheck+`
+		where next_time < now()
+			and enabled
+			and checker_id = $1
+		order by next_time
+		for update skip locked
+		limit 1;`, c.id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNoCheck
@@ -109,14 +154,123 @@ func (c *Checker) Next() error {
 		return fmt.Errorf("could not get next check: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	timeout := c.timeout
+	if check.timeout > 0 {
+		timeout = check.timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	start := time.Now()
 	result := c.executor(check, ctx)
+	duration := time.Since(start)
 	if ctx.Err() == context.DeadlineExceeded {
-		result.Message = fmt.Sprintf("check took longer than %s", c.timeout)
-		result.ExitCode = 2
+		result.Message = fmt.Sprintf("check took longer than %s", timeout)
+		result.ExitCode = stateCritical
+		if check.timeoutMessage.Valid {
+			result.Message = check.timeoutMessage.String
+		}
+		if check.timeoutExitCode.Valid {
+			result.ExitCode = int(check.timeoutExitCode.Int64)
+		}
+		result.PerfData = nil
+	}
+	return c.store(tx, check, result, duration, timeout, c.ident)
+}
+
+// Submit stores the result of a check, which is not executed by a checker
+// but submitted from the outside, like from a batch job. The check must
+// belong to the checker.
+// The same state handling and notifications as in Next are used. Host is
+// stored as the source of the result.
+// ErrNoCheck is returned, when the check does not exist or belongs to a
+// different checker.
+func (c *Checker) Submit(checkID int64, result CheckResult, host string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start database transaction: %w", err)
+	}
+	defer tx.Rollback()
+	check, err := scanCheck(tx.QueryRow(sqlSelectCheck+`
+		where check_id = $1
+			and checker_id = $2
+		for update;`, checkID, c.id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoCheck
+		}
+		return fmt.Errorf("could not get check '%d': %w", checkID, err)
+	}
+	return c.store(tx, check, result, 0, 0, host)
+}
+
+// NextStale forces the state of the next stale check to exitCode. A check is
+// stale, when no result was stored for more than factor times its interval,
+// for example because its checker is not running or a passive check did not
+// receive a result. As the next run is planned one interval after the last
+// result, the check is stale factor - 1 intervals after its next run.
+// Stale checks of all checkers are handled and go through the same state
+// handling and notifications as in Next.
+// ErrNoCheck is returned, when no check is stale.
+func (c *Checker) NextStale(factor float64, exitCode int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start database transaction: %w", err)
+	}
+	defer tx.Rollback()
+	check, err := scanCheck(tx.QueryRow(sqlSelectCheck+`
+		where enabled
+			and next_time < now() - ($1::float8 - 1) * intval
+		order by next_time
+		for update skip locked
+		limit 1;`, factor))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoCheck
+		}
+		return fmt.Errorf("could not get stale check: %w", err)
+	}
+	var last pq.NullTime
+	if err := tx.QueryRow(`select max(time) from check_results where check_id = $1`,
+		check.ID).Scan(&last); err != nil {
+		return fmt.Errorf("could not get last result of check '%d': %w", check.ID, err)
+	}
+	result := CheckResult{ExitCode: exitCode, Message: "stale: no result received yet"}
+	if last.Valid {
+		result.Message = fmt.Sprintf("stale: no result since %s", last.Time.Format("2006-01-02 15:04:05 MST"))
 	}
+	return c.store(tx, check, result, 0, 0, c.ident)
+}
 
+// scanCheck reads a check selected through sqlSelectCheck.
+func scanCheck(row *sql.Row) (Check, error) {
+	check := Check{}
+	var states, history []int64
+	var timeout sql.NullFloat64
+	if err := row.Scan(&check.ID, pq.Array(&check.Command), pq.Array(&states), &check.MappingID,
+		&check.hardState, &check.attempt, &check.maxAttempts, pq.Array(&history),
+		&check.flapping, &check.ackSticky, &check.ackExpired, &check.Options,
+		&check.slowRuns, &timeout, &check.timeoutExitCode, &check.timeoutMessage,
+		&check.flapWindow, &check.flapStart, &check.flapStop); err != nil {
+		return check, err
+	}
+	if timeout.Valid {
+		check.timeout = time.Duration(timeout.Float64 * float64(time.Second))
+	}
+	check.ExitCodes = make([]int, len(states))
+	for i, state := range states {
+		check.ExitCodes[i] = int(state)
+	}
+	check.history = make([]int, len(history))
+	for i, state := range history {
+		check.history[i] = int(state)
+	}
+	return check, nil
+}
+
+// store updates the state of the check with the result, records the result
+// and creates the notifications. The transaction is committed at the end.
+// Duration and timeout are only set, when the check was run by an executor.
+func (c *Checker) store(tx *sql.Tx, check Check, result CheckResult, duration, timeout time.Duration, host string) error {
 	backToOkay := false
 	if len(check.ExitCodes) == 0 && result.ExitCode == 0 {
 		backToOkay = true
@@ -124,27 +278,153 @@ func (c *Checker) Next() error {
 		backToOkay = true
 	}
 
+	// An acknowledgement is removed when the check is okay again, when it
+	// expired or, unless it is sticky, when the state changed.
+	clearAck := backToOkay || check.ackExpired ||
+		(!check.ackSticky && len(check.ExitCodes) > 0 && check.ExitCodes[0] != result.ExitCode)
+
+	// A soft state is rescheduled with the retry interval until it becomes
+	// a hard state.
+	newHard, attempt := hardState(check.hardState, check.attempt, check.maxAttempts, result.ExitCode)
+	soft := result.ExitCode != newHard
+
+	history := []int64{}
+	flapHistory := []int{}
+	if check.flapWindow > 1 {
+		flapHistory = append(flapHistory, result.ExitCode)
+		flapHistory = append(flapHistory, check.history...)
+		if len(flapHistory) > check.flapWindow {
+			flapHistory = flapHistory[:check.flapWindow]
+		}
+	}
+	for _, state := range flapHistory {
+		history = append(history, int64(state))
+	}
+	isFlapping := flapping(flapHistory, check.flapWindow, check.flapping, check.flapStart, check.flapStop)
+
+	// Only runs of an executor are timed. Submitted results keep the slow
+	// runs.
+	slowRuns := check.slowRuns
+	if timeout > 0 && duration > 0 {
+		if duration.Seconds() >= timeout.Seconds()*slowRatio {
+			slowRuns++
+		} else {
+			slowRuns--
+		}
+		if slowRuns > maxSlowRuns {
+			slowRuns = maxSlowRuns
+		} else if slowRuns < 0 {
+			slowRuns = 0
+		}
+	}
+
 	if _, err := tx.Exec(`update active_checks ac
-		set next_time = now() + intval, states = ARRAY[$2::int] || states[1:4],
+		set next_time = now() + case when $5 then coalesce(retry_intval, intval) else intval end,
+				states = ARRAY[$2::int] || states[1:4],
 				msg = $3,
 				acknowledged = case when $4 then false else acknowledged end,
-				state_since = case $2 when states[1] then state_since else now() end
-			where check_id = $1`, check.id, result.ExitCode, result.Message, backToOkay); err != nil {
-		return fmt.Errorf("could not update check '%d': %w", check.id, err)
+				ack_author = case when $4 then null else ack_author end,
+				ack_comment = case when $4 then null else ack_comment end,
+				ack_time = case when $4 then null else ack_time end,
+				ack_expires = case when $4 then null else ack_expires end,
+				ack_sticky = case when $4 then false else ack_sticky end,
+				state_since = case $2 when states[1] then state_since else now() end,
+				hard_since = case when (select target from mapping_level
+						where mapping_id = ac.mapping_id and source = ac.hard_state)
+					is distinct from (select target from mapping_level
+						where mapping_id = ac.mapping_id and source = $6)
+					then now() else hard_since end,
+				hard_state = $6,
+				attempt = $7,
+				history = $8,
+				flapping = $9,
+				escalation_step = case when $2 = 0 then 0 else escalation_step end,
+				last_run = now(),
+				duration = nullif($10::float8, 0) * interval '1 second',
+				executed_by = $11,
+				slow_runs = $12,
+				slow = $13
+			where check_id = $1`, check.ID, result.ExitCode, result.Message, clearAck,
+		soft, newHard, attempt, pq.Array(history), isFlapping, duration.Seconds(), host,
+		slowRuns, slowRuns >= slowRunsWarn); err != nil {
+		return fmt.Errorf("could not update check '%d': %w", check.ID, err)
+	}
+
+	if _, err := tx.Exec(`insert into check_results(check_id, exit_code, duration, output, host)
+		values ($1, $2, $3::float8 * interval '1 second', $4, $5)`,
+		check.ID, result.ExitCode, duration.Seconds(), result.Message, host); err != nil {
+		return fmt.Errorf("could not store result of check '%d': %w", check.ID, err)
+	}
+	for _, p := range result.PerfData {
+		if _, err := tx.Exec(`insert into check_metrics(check_id, label, value, unit, warn, crit, min, max)
+			values ($1, $2, $3, $4, nullif($5, ''), nullif($6, ''), $7, $8)`,
+			check.ID, p.Label, p.Value, p.Unit, p.Warn, p.Crit, p.Min, p.Max); err != nil {
+			return fmt.Errorf("could not store metric '%s' of check '%d': %w", p.Label, check.ID, err)
+		}
+	}
+
+	// Notifications of checks in a downtime are suppressed.
+	inDowntime := false
+	if err := tx.QueryRow(`select check_in_downtime($1)`, check.ID).Scan(&inDowntime); err != nil {
+		return fmt.Errorf("could not check downtimes of check '%d': %w", check.ID, err)
+	}
+	status, lastError := NotificationPending, ""
+	if inDowntime {
+		status, lastError = NotificationSuppressed, "check is in a downtime"
 	}
 
-	if _, err := tx.Exec(`insert into notifications(check_id, states, output, mapping_id, notifier_id, check_host)
-			select $1, array_agg(ml.target), $2, $3, cn.notifier_id, $4
+	// A change of the flapping state replaces the notification of the
+	// state change.
+	if isFlapping != check.flapping {
+		output := "check started flapping: " + result.Message
+		if !isFlapping {
+			output = "check stopped flapping: " + result.Message
+		}
+		if _, err := tx.Exec(`insert into notifications(check_id, states, output, mapping_id, notifier_id, check_host, status, last_error)
+			select $1, array_agg(ml.target order by s.idx), $2, $3, cn.notifier_id, $4, $5::text, nullif($6::text, '')
+			from active_checks ac
+			cross join lateral unnest(ac.states) with ordinality s(state, idx)
+			join checks_notify cn on ac.check_id = cn.check_id
+			join mapping_level ml on ac.mapping_id = ml.mapping_id and s.state = ml.source
+			where ac.check_id = $1
+				and ac.acknowledged = false
+				and cn.enabled = true
+			group by cn.notifier_id;`,
+			check.ID, output, check.MappingID, host, status, lastError); err != nil {
+			return fmt.Errorf("could not create flapping notification '%d': %s", check.ID, err)
+		}
+		return tx.Commit()
+	}
+
+	// Notifications are only created when the mapped hard state changed or
+	// when the notifier wants to be reminded of a check that is still not
+	// okay. While the check is flapping, they are suppressed.
+	if isFlapping && !inDowntime {
+		status, lastError = NotificationSuppressed, "check is flapping"
+	}
+	if _, err := tx.Exec(`insert into notifications(check_id, states, output, mapping_id, notifier_id, check_host, status, last_error)
+			select $1, array_agg(ml.target order by s.idx), $2, $3, cn.notifier_id, $4, $7::text, nullif($8::text, '')
 			from active_checks ac
-			cross join lateral unnest(ac.states) s
+			cross join lateral unnest(ac.states) with ordinality s(state, idx)
 			join checks_notify cn on ac.check_id = cn.check_id
-			join mapping_level ml on ac.mapping_id = ml.mapping_id and s.s = ml.source
+			join notifier no on cn.notifier_id = no.id
+			join mapping_level ml on ac.mapping_id = ml.mapping_id and s.state = ml.source
+			left join mapping_level mo on ac.mapping_id = mo.mapping_id and mo.source = $5
+			left join mapping_level mn on ac.mapping_id = mn.mapping_id and mn.source = $6
 			where ac.check_id = $1
 				and ac.acknowledged = false
-				and cn.enabled = true 
-			group by cn.notifier_id;`, check.id, result.Message, check.mappingId, c.ident); err != nil {
-		return fmt.Errorf("could not create notification '%d': %s", check.id, err)
+				and cn.enabled = true
+			group by cn.notifier_id, no.renotify_interval, mo.target, mn.target
+			having mo.target is distinct from mn.target
+				or (mn.target != 0
+					and no.renotify_interval is not null
+					and not exists (select 1 from notifications n
+						where n.check_id = $1
+							and n.notifier_id = cn.notifier_id
+							and n.inserted > now() - no.renotify_interval));`,
+		check.ID, result.Message, check.MappingID, host, check.hardState, newHard,
+		status, lastError); err != nil {
+		return fmt.Errorf("could not create notification '%d': %s", check.ID, err)
 	}
-	tx.Commit()
-	return nil
+	return tx.Commit()
 }
@@ -0,0 +1,84 @@
+package monzero
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+type (
+	// Notifier delivers notifications to a target, for example a mail
+	// address or a webhook.
+	// A notifier is created from the settings of an entry in the notifier
+	// table.
+	Notifier interface {
+		// Notify must deliver the notification in the time of the context.
+		// The result is stored with the notification, also when the delivery
+		// failed.
+		Notify(Notification, context.Context) (NotifyResult, error)
+	}
+
+	// NotifyResult contains the details of a delivery, like the exit code
+	// of a command or the status code of a request, and its output.
+	NotifyResult struct {
+		Code   int
+		Output string
+	}
+
+	// NotifierFactory creates a notifier from the raw settings of an entry
+	// in the notifier table.
+	NotifierFactory func(settings []byte) (Notifier, error)
+
+	// Notifiers maps the type of a notifier to the factory creating it.
+	Notifiers map[string]NotifierFactory
+
+	// LogNotifier writes the notifications to the log.
+	LogNotifier struct{}
+)
+
+var (
+	// DefaultNotifiers contains all notifier types shipped with monzero.
+	// Register additional types here or set SenderConfig.Notifiers.
+	DefaultNotifiers = Notifiers{
+		"log":     NewLogNotifier,
+		"smtp":    NewSMTPNotifier,
+		"webhook": NewWebhookNotifier,
+		"exec":    NewExecNotifier,
+	}
+)
+
+// Register adds a new notifier type. An existing type with the same name is
+// replaced.
+func (n Notifiers) Register(name string, factory NotifierFactory) {
+	n[name] = factory
+}
+
+// New creates a notifier from the settings of a notifier entry.
+// The settings must contain the key `type` to select the notifier type.
+func (n Notifiers) New(settings []byte) (Notifier, error) {
+	t := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(settings, &t); err != nil {
+		return nil, fmt.Errorf("could not parse notifier settings: %w", err)
+	}
+	if t.Type == "" {
+		return nil, fmt.Errorf("notifier settings contain no type")
+	}
+	factory, found := n[t.Type]
+	if !found {
+		return nil, fmt.Errorf("notifier type '%s' is unknown", t.Type)
+	}
+	return factory(settings)
+}
+
+func NewLogNotifier(_ []byte) (Notifier, error) {
+	return &LogNotifier{}, nil
+}
+
+func (l *LogNotifier) Notify(n Notification, _ context.Context) (NotifyResult, error) {
+	log.Printf("notification %d for %s on %s via %s: states %v: %s",
+		n.ID, n.CheckName, n.NodeName, n.NotifierName, n.States, n.Output)
+	return NotifyResult{}, nil
+}
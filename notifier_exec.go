@@ -0,0 +1,107 @@
+package monzero
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type (
+	// ExecNotifier runs a command for every notification.
+	// The notification is handed to the command as environment variables
+	// prefixed with MONZERO_ and as a JSON document on stdin.
+	ExecNotifier struct {
+		// Command is the path to the program followed by its arguments.
+		Command []string `json:"command"`
+		Timeout string   `json:"timeout"`
+
+		timeout time.Duration
+	}
+)
+
+// NewExecNotifier creates a command notifier from the notifier settings.
+func NewExecNotifier(settings []byte) (Notifier, error) {
+	e := &ExecNotifier{Timeout: "30s"}
+	if err := json.Unmarshal(settings, e); err != nil {
+		return nil, fmt.Errorf("could not parse exec settings: %w", err)
+	}
+	if len(e.Command) == 0 || e.Command[0] == "" {
+		return nil, fmt.Errorf("exec command must be set")
+	}
+	var err error
+	if e.timeout, err = time.ParseDuration(e.Timeout); err != nil {
+		return nil, fmt.Errorf("could not parse timeout: %w", err)
+	}
+	return e, nil
+}
+
+func (e *ExecNotifier) Notify(n Notification, ctx context.Context) (NotifyResult, error) {
+	result := NotifyResult{}
+	payload, err := json.Marshal(n.Payload())
+	if err != nil {
+		return result, fmt.Errorf("could not encode payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.Env = append(os.Environ(), n.Environment()...)
+	cmd.Stdin = bytes.NewReader(payload)
+	output := bytes.NewBuffer([]byte{})
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Run()
+	result.Output = output.String()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Code = -1
+			return result, fmt.Errorf("command took longer than %s", e.timeout)
+		}
+		if cmd.ProcessState == nil {
+			result.Code = -1
+			return result, fmt.Errorf("unknown error when running command: %s", err)
+		}
+		status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		if !ok {
+			result.Code = -1
+			return result, fmt.Errorf("error running command: %s", err)
+		}
+		result.Code = status.ExitStatus()
+		return result, fmt.Errorf("command exited with code %d", result.Code)
+	}
+	return result, nil
+}
+
+// Environment returns the notification as a list of environment variables.
+func (n Notification) Environment() []string {
+	states := make([]string, len(n.States))
+	for i, state := range n.States {
+		states[i] = strconv.Itoa(state)
+	}
+	state := ""
+	if len(states) > 0 {
+		state = states[0]
+	}
+	return []string{
+		"MONZERO_NOTIFICATION_ID=" + strconv.FormatInt(n.ID, 10),
+		"MONZERO_CHECK_ID=" + strconv.FormatInt(n.CheckID, 10),
+		"MONZERO_CHECK=" + n.CheckName,
+		"MONZERO_NODE=" + n.NodeName,
+		"MONZERO_COMMAND=" + n.CommandName,
+		"MONZERO_STATE=" + state,
+		"MONZERO_STATE_TITLE=" + n.StateTitle,
+		"MONZERO_STATES=" + strings.Join(states, " "),
+		"MONZERO_OUTPUT=" + n.Output,
+		"MONZERO_INSERTED=" + n.Inserted.Format(time.RFC3339),
+		"MONZERO_CHECK_HOST=" + n.CheckHost,
+		"MONZERO_NOTIFIER=" + n.NotifierName,
+		"MONZERO_ESCALATION_STEP=" + strconv.Itoa(n.EscalationStep),
+	}
+}
@@ -0,0 +1,64 @@
+package monzero
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecNotifier(t *testing.T) {
+	n := Notification{ID: 5, CheckID: 12, CheckName: "ping", NodeName: "localhost", States: []int{2, 0}}
+
+	// The command prints the environment in the first line and the payload
+	// from stdin in the second line.
+	notifier, err := DefaultNotifiers.New([]byte(`{"type": "exec", "command": ["/bin/sh", "-c",
+		"echo \"$MONZERO_CHECK_ID $MONZERO_NODE $MONZERO_STATE $MONZERO_STATES\"; cat; echo; exit 3"]}`))
+	if err != nil {
+		t.Fatalf("could not create notifier: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := notifier.Notify(n, ctx)
+	if err == nil {
+		t.Errorf("expected an error for exit code 3")
+	}
+	if result.Code != 3 {
+		t.Errorf("expected code 3, got %d", result.Code)
+	}
+	lines := strings.Split(result.Output, "\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected environment and payload in output, got %q", result.Output)
+	}
+	if lines[0] != "12 localhost 2 2 0" {
+		t.Errorf("unexpected environment %q", lines[0])
+	}
+	received := NotificationPayload{}
+	if err := json.Unmarshal([]byte(lines[1]), &received); err != nil {
+		t.Fatalf("could not parse payload %q: %s", lines[1], err)
+	}
+	if received.ID != 5 || received.CheckID != 12 || received.Check != "ping" || len(received.States) != 2 {
+		t.Errorf("received unexpected payload: %#v", received)
+	}
+
+	notifier, err = DefaultNotifiers.New([]byte(`{"type": "exec", "command": ["/bin/sh", "-c", "exit 0"]}`))
+	if err != nil {
+		t.Fatalf("could not create notifier: %s", err)
+	}
+	if result, err := notifier.Notify(n, ctx); err != nil || result.Code != 0 {
+		t.Errorf("expected code 0 without error, got %d: %v", result.Code, err)
+	}
+
+	notifier, err = DefaultNotifiers.New([]byte(`{"type": "exec", "command": ["/bin/sleep", "5"], "timeout": "50ms"}`))
+	if err != nil {
+		t.Fatalf("could not create notifier: %s", err)
+	}
+	result, err = notifier.Notify(n, ctx)
+	if err == nil {
+		t.Errorf("expected an error for the timeout")
+	}
+	if result.Code != -1 {
+		t.Errorf("expected code -1 on timeout, got %d", result.Code)
+	}
+}
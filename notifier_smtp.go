@@ -0,0 +1,175 @@
+package monzero
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	SMTPDefaultSubject = `[{{ .StateTitle }}] {{ .CheckName }} on {{ .NodeName }}`
+	SMTPDefaultBody    = `check:   {{ .CheckName }}
+node:    {{ .NodeName }}
+command: {{ .CommandName }}
+state:   {{ .StateTitle }}
+states:  {{ .States }}
+time:    {{ .Inserted.Format "2006.01.02 15:04:05 MST" }}
+source:  {{ .CheckHost }}
+
+{{ .Output }}
+`
+)
+
+type (
+	// SMTPNotifier sends notifications as mails.
+	SMTPNotifier struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+		// TLS selects the transport security. It can be one of
+		// none - plain text connection
+		// starttls - upgrade the connection through STARTTLS
+		// tls - use implicit TLS
+		TLS                string   `json:"tls"`
+		InsecureSkipVerify bool     `json:"insecure_skip_verify"`
+		Username           string   `json:"username"`
+		Password           string   `json:"password"`
+		From               string   `json:"from"`
+		To                 []string `json:"to"`
+		// Subject and Body are text/templates getting the notification.
+		Subject string `json:"subject"`
+		Body    string `json:"body"`
+
+		subject *template.Template
+		body    *template.Template
+	}
+)
+
+// NewSMTPNotifier creates a mail notifier from the notifier settings.
+func NewSMTPNotifier(settings []byte) (Notifier, error) {
+	s := &SMTPNotifier{
+		Port:    25,
+		TLS:     "starttls",
+		Subject: SMTPDefaultSubject,
+		Body:    SMTPDefaultBody,
+	}
+	if err := json.Unmarshal(settings, s); err != nil {
+		return nil, fmt.Errorf("could not parse smtp settings: %w", err)
+	}
+	if s.Host == "" {
+		return nil, fmt.Errorf("smtp host must be set")
+	}
+	if s.From == "" {
+		return nil, fmt.Errorf("smtp from must be set")
+	}
+	if len(s.To) == 0 {
+		return nil, fmt.Errorf("smtp needs at least one recipient")
+	}
+	switch s.TLS {
+	case "none", "starttls", "tls":
+	default:
+		return nil, fmt.Errorf("smtp tls mode '%s' is unknown", s.TLS)
+	}
+	var err error
+	if s.subject, err = template.New("subject").Parse(s.Subject); err != nil {
+		return nil, fmt.Errorf("could not parse subject template: %w", err)
+	}
+	if s.body, err = template.New("body").Parse(s.Body); err != nil {
+		return nil, fmt.Errorf("could not parse body template: %w", err)
+	}
+	return s, nil
+}
+
+func (s *SMTPNotifier) Notify(n Notification, ctx context.Context) (NotifyResult, error) {
+	msg, err := s.message(n)
+	if err != nil {
+		return NotifyResult{}, err
+	}
+
+	tlsConf := &tls.Config{
+		ServerName:         s.Host,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if s.TLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConf}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return NotifyResult{}, fmt.Errorf("could not connect to '%s': %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return NotifyResult{}, fmt.Errorf("could not start smtp session: %w", err)
+	}
+	defer client.Close()
+	if s.TLS == "starttls" {
+		if err := client.StartTLS(tlsConf); err != nil {
+			return NotifyResult{}, fmt.Errorf("could not start tls: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return NotifyResult{}, fmt.Errorf("could not authenticate: %w", err)
+		}
+	}
+	if err := client.Mail(s.From); err != nil {
+		return NotifyResult{}, fmt.Errorf("sender '%s' was rejected: %w", s.From, err)
+	}
+	for _, to := range s.To {
+		if err := client.Rcpt(to); err != nil {
+			return NotifyResult{}, fmt.Errorf("recipient '%s' was rejected: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return NotifyResult{}, fmt.Errorf("could not start data transfer: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return NotifyResult{}, fmt.Errorf("could not write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return NotifyResult{}, fmt.Errorf("message was rejected: %w", err)
+	}
+	return NotifyResult{}, client.Quit()
+}
+
+// message renders the complete mail including the header.
+func (s *SMTPNotifier) message(n Notification) ([]byte, error) {
+	subject := &strings.Builder{}
+	if err := s.subject.Execute(subject, n); err != nil {
+		return nil, fmt.Errorf("could not render subject: %w", err)
+	}
+	body := &bytes.Buffer{}
+	if err := s.body.Execute(body, n); err != nil {
+		return nil, fmt.Errorf("could not render body: %w", err)
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(msg, "Content-Transfer-Encoding: 8bit\r\n")
+	fmt.Fprintf(msg, "\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
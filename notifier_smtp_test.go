@@ -0,0 +1,124 @@
+package monzero
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink accepts a single smtp session and returns the transferred
+// envelope and data.
+func smtpSink(t *testing.T, l net.Listener, result chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Errorf("could not accept connection: %s", err)
+		close(result)
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	session := &strings.Builder{}
+	fmt.Fprintf(conn, "220 localhost sink\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Errorf("could not read command: %s", err)
+			close(result)
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			fmt.Fprintf(conn, "250 localhost\r\n")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			session.WriteString(strings.TrimSpace(line) + "\n")
+			fmt.Fprintf(conn, "250 ok\r\n")
+		case cmd == "DATA":
+			fmt.Fprintf(conn, "354 go ahead\r\n")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					t.Errorf("could not read data: %s", err)
+					close(result)
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				session.WriteString(strings.TrimRight(line, "\r\n") + "\n")
+			}
+			fmt.Fprintf(conn, "250 queued\r\n")
+		case cmd == "QUIT":
+			fmt.Fprintf(conn, "221 bye\r\n")
+			result <- session.String()
+			return
+		default:
+			fmt.Fprintf(conn, "502 not implemented\r\n")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start listener: %s", err)
+	}
+	defer l.Close()
+	result := make(chan string, 1)
+	go smtpSink(t, l, result)
+
+	settings := fmt.Sprintf(`{"type": "smtp", "host": "127.0.0.1", "port": %d, "tls": "none",
+		"from": "monzero@example.com", "to": ["ops@example.com", "oncall@example.com"],
+		"subject": "{{ .StateTitle }} {{ .NodeName }}/{{ .CheckName }}",
+		"body": "{{ .Output }} {{ .States }}"}`,
+		l.Addr().(*net.TCPAddr).Port)
+	notifier, err := DefaultNotifiers.New([]byte(settings))
+	if err != nil {
+		t.Fatalf("could not create notifier: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = notifier.Notify(Notification{
+		CheckName:  "ping",
+		NodeName:   "localhost",
+		StateTitle: "critical",
+		States:     []int{2, 0},
+		Output:     "host unreachable",
+		Inserted:   time.Now(),
+	}, ctx)
+	if err != nil {
+		t.Fatalf("could not send notification: %s", err)
+	}
+
+	session := <-result
+	for _, expected := range []string{
+		"MAIL FROM:<monzero@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<oncall@example.com>",
+		"Subject: critical localhost/ping\n",
+		"\nhost unreachable [2 0]\n",
+	} {
+		if !strings.Contains(session, expected) {
+			t.Errorf("session does not contain %q:\n%s", expected, session)
+		}
+	}
+}
+
+func TestSMTPNotifierSettings(t *testing.T) {
+	for i, settings := range []string{
+		`{"type": "smtp", "from": "a@example.com", "to": ["b@example.com"]}`,
+		`{"type": "smtp", "host": "localhost", "to": ["b@example.com"]}`,
+		`{"type": "smtp", "host": "localhost", "from": "a@example.com"}`,
+		`{"type": "smtp", "host": "localhost", "from": "a@example.com", "to": ["b@example.com"], "tls": "maybe"}`,
+		`{"type": "smtp", "host": "localhost", "from": "a@example.com", "to": ["b@example.com"], "subject": "{{ .Foo"}`,
+	} {
+		if _, err := NewSMTPNotifier([]byte(settings)); err == nil {
+			t.Errorf("settings %d were accepted but should be rejected", i)
+		}
+	}
+}
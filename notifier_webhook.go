@@ -0,0 +1,149 @@
+package monzero
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = `X-Monzero-Signature`
+)
+
+type (
+	// WebhookNotifier posts every notification as a JSON document to an URL.
+	WebhookNotifier struct {
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		// Secret is used as the key to sign the payload with HMAC-SHA256.
+		// The signature is sent hex encoded in the SignatureHeader.
+		Secret             string `json:"secret"`
+		SignatureHeader    string `json:"signature_header"`
+		InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+		// Retries is the number of retries after the first attempt failed.
+		Retries    int    `json:"retries"`
+		Backoff    string `json:"backoff"`
+		MaxBackoff string `json:"max_backoff"`
+
+		backoff    time.Duration
+		maxBackoff time.Duration
+		client     *http.Client
+	}
+)
+
+// NewWebhookNotifier creates a webhook notifier from the notifier settings.
+func NewWebhookNotifier(settings []byte) (Notifier, error) {
+	w := &WebhookNotifier{
+		SignatureHeader: WebhookSignatureHeader,
+		Retries:         3,
+		Backoff:         "1s",
+		MaxBackoff:      "30s",
+	}
+	if err := json.Unmarshal(settings, w); err != nil {
+		return nil, fmt.Errorf("could not parse webhook settings: %w", err)
+	}
+	if w.URL == "" {
+		return nil, fmt.Errorf("webhook url must be set")
+	}
+	if w.Retries < 0 {
+		return nil, fmt.Errorf("webhook retries must not be negative")
+	}
+	var err error
+	if w.backoff, err = time.ParseDuration(w.Backoff); err != nil {
+		return nil, fmt.Errorf("could not parse backoff: %w", err)
+	}
+	if w.maxBackoff, err = time.ParseDuration(w.MaxBackoff); err != nil {
+		return nil, fmt.Errorf("could not parse max backoff: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: w.InsecureSkipVerify}
+	w.client = &http.Client{Transport: transport}
+	return w, nil
+}
+
+func (w *WebhookNotifier) Notify(n Notification, ctx context.Context) (NotifyResult, error) {
+	payload, err := json.Marshal(n.Payload())
+	if err != nil {
+		return NotifyResult{}, fmt.Errorf("could not encode payload: %w", err)
+	}
+	return w.send(ctx, payload)
+}
+
+// NotifyDigest posts the digest as one JSON document.
+func (w *WebhookNotifier) NotifyDigest(d Digest, ctx context.Context) (NotifyResult, error) {
+	payload, err := json.Marshal(d.Payload())
+	if err != nil {
+		return NotifyResult{}, fmt.Errorf("could not encode payload: %w", err)
+	}
+	return w.send(ctx, payload)
+}
+
+// send posts the payload and retries with an increasing backoff, as long as
+// the error can be retried.
+func (w *WebhookNotifier) send(ctx context.Context, payload []byte) (NotifyResult, error) {
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		result, retry, err := w.post(ctx, payload)
+		if err == nil {
+			return result, nil
+		}
+		if !retry || attempt >= w.Retries {
+			return result, fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+// post sends the payload once. When the request failed, it returns if the
+// request can be retried.
+func (w *WebhookNotifier) post(ctx context.Context, payload []byte) (NotifyResult, bool, error) {
+	result := NotifyResult{}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return result, false, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range w.Headers {
+		req.Header.Set(key, val)
+	}
+	if w.Secret != "" {
+		req.Header.Set(w.SignatureHeader, "sha256="+hex.EncodeToString(MAC([]byte(w.Secret), payload)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return result, true, fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	result.Code = resp.StatusCode
+	result.Output = string(body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return result, false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return result, retry, fmt.Errorf("webhook returned status %s", resp.Status)
+}
+
+// MAC computes the HMAC-SHA256 of the input with the given key.
+func MAC(key, input []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
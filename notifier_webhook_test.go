@@ -0,0 +1,87 @@
+package monzero
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	calls := 0
+	received := NotificationPayload{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("could not read body: %s", err)
+		}
+		sig, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(WebhookSignatureHeader), "sha256="))
+		if err != nil {
+			t.Errorf("could not decode signature: %s", err)
+		}
+		if !hmac.Equal(sig, MAC([]byte("secret"), body)) {
+			t.Errorf("signature does not match")
+		}
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("could not parse payload: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	notifier, err := DefaultNotifiers.New([]byte(fmt.Sprintf(
+		`{"type": "webhook", "url": "%s", "secret": "secret", "backoff": "1ms"}`, srv.URL)))
+	if err != nil {
+		t.Fatalf("could not create notifier: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := notifier.Notify(Notification{ID: 5, CheckID: 12, NodeName: "localhost", States: []int{2, 0}}, ctx); err != nil {
+		t.Fatalf("could not send notification: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+	if received.CheckID != 12 || received.Node != "localhost" || len(received.States) != 2 {
+		t.Errorf("received unexpected payload: %#v", received)
+	}
+}
+
+func TestWebhookNotifierGiveUp(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	for path, expected := range map[string]int{"/missing": 1, "/broken": 3} {
+		calls = 0
+		notifier, err := DefaultNotifiers.New([]byte(fmt.Sprintf(
+			`{"type": "webhook", "url": "%s%s", "retries": 2, "backoff": "1ms"}`, srv.URL, path)))
+		if err != nil {
+			t.Fatalf("could not create notifier: %s", err)
+		}
+		if _, err := notifier.Notify(Notification{}, context.Background()); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+		if calls != expected {
+			t.Errorf("%s: expected %d calls, got %d", path, expected, calls)
+		}
+	}
+}
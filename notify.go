@@ -0,0 +1,427 @@
+package monzero
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNoNotification = fmt.Errorf("no notification found to send")
+)
+
+const (
+	// The states of a notification.
+	NotificationPending    = "pending"
+	NotificationSent       = "sent"
+	NotificationFailed     = "failed"
+	NotificationSuppressed = "suppressed"
+)
+
+type (
+	// Sender maintains the delivery of notifications.
+	Sender struct {
+		db               *sql.DB
+		notifiers        Notifiers
+		timeout          time.Duration
+		maxAttempts      int
+		retryInterval    time.Duration
+		maxRetryInterval time.Duration
+	}
+
+	SenderConfig struct {
+		// DB is the connection to the database to use.
+		DB *sql.DB
+
+		// Timeout is the duration a notification has time to be delivered.
+		Timeout time.Duration
+
+		// Notifiers contains the notifier types which can be used to deliver
+		// notifications. The type is selected through the `type` key in the
+		// settings of the notifier.
+		// When not set, DefaultNotifiers is used.
+		Notifiers Notifiers
+
+		// MaxAttempts is the number of delivery attempts after which a
+		// notification is marked as failed.
+		MaxAttempts int
+
+		// RetryInterval is the time to wait after the first failed attempt.
+		// It is doubled with every further failed attempt up to
+		// MaxRetryInterval.
+		RetryInterval    time.Duration
+		MaxRetryInterval time.Duration
+	}
+
+	// Notification contains all information about a notification that needs
+	// to be delivered.
+	Notification struct {
+		ID          int64
+		CheckID     int64
+		CheckName   string
+		NodeName    string
+		CommandName string
+		MappingID   int
+		// States contains the mapped states of the check, the newest first.
+		States []int
+		// StateTitle is the title of the newest mapped state.
+		StateTitle string
+		Output     string
+		Inserted   time.Time
+		CheckHost  string // the host which generated the notification
+		// EscalationStep is the step of the escalation policy which created
+		// the notification or 0, when it was not created by an escalation.
+		EscalationStep int
+		// Groups contains the names of the groups of the node.
+		Groups []string
+
+		NotifierID       int
+		NotifierName     string
+		NotifierSettings []byte // the raw settings of the notifier
+
+		Attempts int // the number of failed delivery attempts
+
+		muted    bool          // are notifications of the check muted
+		periodID sql.NullInt64 // the time period restricting the delivery
+		batched  bool          // is the notification delivered in a digest
+	}
+
+	// NotificationPayload is the JSON document describing a notification
+	// handed to webhooks and commands.
+	NotificationPayload struct {
+		ID         int64     `json:"id"`
+		CheckID    int64     `json:"check_id"`
+		Check      string    `json:"check"`
+		Node       string    `json:"node"`
+		Command    string    `json:"command"`
+		States     []int     `json:"states"`
+		StateTitle string    `json:"state_title"`
+		Output     string    `json:"output"`
+		Inserted   time.Time `json:"inserted"`
+		CheckHost  string    `json:"check_host"`
+
+		EscalationStep int      `json:"escalation_step,omitempty"`
+		Groups         []string `json:"groups"`
+	}
+)
+
+func NewSender(cfg SenderConfig) (*Sender, error) {
+	s := &Sender{
+		db:               cfg.DB,
+		notifiers:        cfg.Notifiers,
+		timeout:          cfg.Timeout,
+		maxAttempts:      cfg.MaxAttempts,
+		retryInterval:    cfg.RetryInterval,
+		maxRetryInterval: cfg.MaxRetryInterval,
+	}
+	if s.notifiers == nil {
+		s.notifiers = DefaultNotifiers
+	}
+	if s.maxAttempts < 1 {
+		return nil, fmt.Errorf("max attempts must be at least 1")
+	}
+	if s.retryInterval <= 0 || s.maxRetryInterval < s.retryInterval {
+		return nil, fmt.Errorf("retry interval must be positive and not larger than the max retry interval")
+	}
+	return s, nil
+}
+
+// sqlSelectNotification selects the pending notifications which are due.
+// The caller must add further conditions, the order and the locking.
+const sqlSelectNotification = `select n.id, n.check_id, c.name, nd.name, co.name, n.mapping_id,
+		n.states, n.output, n.inserted, n.check_host, no.id, no.name, no.settings,
+		coalesce((select ml.title from mapping_level ml
+			where ml.mapping_id = n.mapping_id and ml.target = n.states[1]
+			order by ml.source limit 1), ''),
+		n.attempts, coalesce(not cn.enabled, false), n.escalation_step,
+		coalesce(cn.timeperiod_id, no.timeperiod_id),
+		array(select g.name from nodes_groups ng
+			join groups g on ng.group_id = g.id
+			where ng.node_id = c.node_id
+			order by g.name),
+		no.batch_window is not null
+	from notifications n
+	join checks c on n.check_id = c.id
+	join nodes nd on c.node_id = nd.id
+	join commands co on c.command_id = co.id
+	join notifier no on n.notifier_id = no.id
+	left join checks_notify cn on n.check_id = cn.check_id and n.notifier_id = cn.notifier_id
+	where n.status = 'pending'
+		and n.next_try <= now()`
+
+// Next pulls the next pending notification and delivers it through the
+// notifier it references.
+// When the delivery failed, the notification is tried again later with an
+// increasing interval until the maximum number of attempts is reached.
+// The result of the notifier is stored with the notification in any case.
+// Notifications of a notifier with a batch window are delivered as a digest,
+// once the oldest of them is older than the batch window.
+func (s *Sender) Next() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start database transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := scanNotification(tx.QueryRow(sqlSelectNotification + `
+			and (no.batch_window is null or n.inserted <= now() - no.batch_window)
+		order by n.next_try
+		for update of n skip locked
+		limit 1;`))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoNotification
+		}
+		return fmt.Errorf("could not get next notification: %w", err)
+	}
+	if n.batched {
+		return s.sendDigest(tx, n)
+	}
+
+	if deliver, err := s.admit(tx, n); err != nil {
+		return err
+	} else if !deliver {
+		return commit(tx, n.ID)
+	}
+
+	notifier, err := s.notifiers.New(n.NotifierSettings)
+	if err != nil {
+		return s.fail(tx, n, NotifyResult{}, fmt.Errorf("could not create notifier: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	result, err := notifier.Notify(n, ctx)
+	if err != nil {
+		return s.fail(tx, n, result, err)
+	}
+	return s.store(tx, n, NotificationSent, "", result)
+}
+
+// scanNotification reads a notification selected with sqlSelectNotification.
+func scanNotification(row interface{ Scan(...any) error }) (Notification, error) {
+	n := Notification{}
+	var (
+		output    sql.NullString
+		checkHost sql.NullString
+		step      sql.NullInt64
+		states    []int64
+	)
+	err := row.Scan(&n.ID, &n.CheckID, &n.CheckName, &n.NodeName, &n.CommandName, &n.MappingID,
+		pq.Array(&states), &output, &n.Inserted, &checkHost, &n.NotifierID,
+		&n.NotifierName, &n.NotifierSettings, &n.StateTitle, &n.Attempts, &n.muted, &step,
+		&n.periodID, pq.Array(&n.Groups), &n.batched)
+	if err != nil {
+		return n, err
+	}
+	n.Output = output.String
+	n.CheckHost = checkHost.String
+	n.EscalationStep = int(step.Int64)
+	n.States = make([]int, len(states))
+	for i, state := range states {
+		n.States[i] = int(state)
+	}
+	return n, nil
+}
+
+// admit decides if the notification can be delivered now. Notifications of
+// muted checks and outside of the time period are stored accordingly.
+// The time period of the check overrides the one of the notifier.
+func (s *Sender) admit(tx *sql.Tx, n Notification) (bool, error) {
+	if n.muted {
+		return false, s.record(tx, n, NotificationSuppressed, "notifications of the check are muted", NotifyResult{})
+	}
+	if !n.periodID.Valid {
+		return true, nil
+	}
+	period, err := loadTimePeriod(tx, n.periodID.Int64)
+	if err != nil {
+		return false, err
+	}
+	deliver, holdUntil := period.Apply(time.Now())
+	if deliver {
+		return true, nil
+	}
+	if holdUntil.IsZero() {
+		return false, s.record(tx, n, NotificationSuppressed,
+			fmt.Sprintf("outside of time period '%s'", period.Name), NotifyResult{})
+	}
+	return false, s.hold(tx, n, holdUntil, fmt.Sprintf("held until time period '%s' opens", period.Name))
+}
+
+// sendDigest delivers all due notifications of the notifier of first as one
+// digest.
+// Notifiers implementing DigestNotifier get the complete digest, all others
+// get a summary of the digest as a single notification.
+func (s *Sender) sendDigest(tx *sql.Tx, first Notification) error {
+	rows, err := tx.Query(sqlSelectNotification+`
+			and n.notifier_id = $1
+		order by n.inserted
+		for update of n skip locked;`, first.NotifierID)
+	if err != nil {
+		return fmt.Errorf("could not get notifications for digest: %w", err)
+	}
+	pending := []Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("could not scan notification for digest: %w", err)
+		}
+		pending = append(pending, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not get notifications for digest: %w", err)
+	}
+
+	d := Digest{
+		NotifierID:   first.NotifierID,
+		NotifierName: first.NotifierName,
+	}
+	ids := []int64{}
+	for _, n := range pending {
+		if deliver, err := s.admit(tx, n); err != nil {
+			return err
+		} else if deliver {
+			d.Notifications = append(d.Notifications, n)
+			ids = append(ids, n.ID)
+		}
+	}
+	if len(d.Notifications) == 0 {
+		return commit(tx, first.ID)
+	}
+
+	if err := tx.QueryRow(`insert into digests(notifier_id, notifications) values ($1, $2) returning id`,
+		d.NotifierID, len(d.Notifications)).Scan(&d.ID); err != nil {
+		return fmt.Errorf("could not create digest: %w", err)
+	}
+
+	result := NotifyResult{}
+	notifier, err := s.notifiers.New(first.NotifierSettings)
+	if err != nil {
+		err = fmt.Errorf("could not create notifier: %w", err)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		if dn, ok := notifier.(DigestNotifier); ok {
+			result, err = dn.NotifyDigest(d, ctx)
+		} else {
+			result, err = notifier.Notify(d.Notification(), ctx)
+		}
+	}
+
+	status, lastError := NotificationSent, ""
+	if err != nil {
+		status, lastError = NotificationFailed, err.Error()
+	}
+	if _, err := tx.Exec(`update digests
+		set status = $2, last_error = nullif($3::text, ''), result_code = $4, result_output = $5
+		where id = $1`, d.ID, status, lastError, result.Code, result.Output); err != nil {
+		return fmt.Errorf("could not store result of digest '%d': %w", d.ID, err)
+	}
+	if _, err := tx.Exec(`update notifications set digest_id = $1 where id = any($2::bigint[])`,
+		d.ID, pq.Array(ids)); err != nil {
+		return fmt.Errorf("could not link notifications to digest '%d': %w", d.ID, err)
+	}
+	for _, n := range d.Notifications {
+		status := NotificationSent
+		if err != nil {
+			status = NotificationPending
+			if n.Attempts+1 >= s.maxAttempts {
+				status = NotificationFailed
+			}
+		}
+		if err := s.record(tx, n, status, lastError, result); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit digest '%d': %w", d.ID, err)
+	}
+	if err != nil {
+		return fmt.Errorf("could not deliver digest '%d' to '%s': %w", d.ID, d.NotifierName, err)
+	}
+	return nil
+}
+
+// fail stores a failed delivery attempt. The notification is scheduled for
+// another attempt, as long as the maximum number of attempts is not reached.
+func (s *Sender) fail(tx *sql.Tx, n Notification, result NotifyResult, notifyErr error) error {
+	status := NotificationPending
+	if n.Attempts+1 >= s.maxAttempts {
+		status = NotificationFailed
+	}
+	if err := s.store(tx, n, status, notifyErr.Error(), result); err != nil {
+		return err
+	}
+	return fmt.Errorf("could not deliver notification '%d' to '%s': %w", n.ID, n.NotifierName, notifyErr)
+}
+
+// store writes the outcome of a delivery attempt and commits the transaction.
+func (s *Sender) store(tx *sql.Tx, n Notification, status, lastError string, result NotifyResult) error {
+	if err := s.record(tx, n, status, lastError, result); err != nil {
+		return err
+	}
+	return commit(tx, n.ID)
+}
+
+// record writes the outcome of a delivery attempt.
+func (s *Sender) record(tx *sql.Tx, n Notification, status, lastError string, result NotifyResult) error {
+	retry := s.retryInterval * time.Duration(1<<n.Attempts)
+	if retry > s.maxRetryInterval || retry <= 0 {
+		retry = s.maxRetryInterval
+	}
+	if _, err := tx.Exec(`update notifications
+		set status = $2::text,
+			sent = case when $2::text = 'sent' then now() end,
+			attempts = attempts + case when $2::text = 'suppressed' then 0 else 1 end,
+			last_error = nullif($3::text, ''),
+			next_try = case when $2::text = 'pending' then now() + $4::float8 * interval '1 second' end,
+			result_code = $5, result_output = $6
+		where id = $1`, n.ID, status, lastError, retry.Seconds(), result.Code, result.Output); err != nil {
+		return fmt.Errorf("could not store result of notification '%d': %w", n.ID, err)
+	}
+	return nil
+}
+
+// hold delays the delivery of the notification until the given time without
+// counting it as an attempt.
+func (s *Sender) hold(tx *sql.Tx, n Notification, until time.Time, reason string) error {
+	if _, err := tx.Exec(`update notifications
+		set next_try = $2, last_error = $3
+		where id = $1`, n.ID, until, reason); err != nil {
+		return fmt.Errorf("could not hold notification '%d': %w", n.ID, err)
+	}
+	return nil
+}
+
+// commit commits the transaction of a notification.
+func commit(tx *sql.Tx, id int64) error {
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit notification '%d': %w", id, err)
+	}
+	return nil
+}
+
+// Payload returns the document describing the notification.
+func (n Notification) Payload() NotificationPayload {
+	return NotificationPayload{
+		ID:         n.ID,
+		CheckID:    n.CheckID,
+		Check:      n.CheckName,
+		Node:       n.NodeName,
+		Command:    n.CommandName,
+		States:     n.States,
+		StateTitle: n.StateTitle,
+		Output:     n.Output,
+		Inserted:   n.Inserted,
+		CheckHost:  n.CheckHost,
+
+		EscalationStep: n.EscalationStep,
+		Groups:         n.Groups,
+	}
+}
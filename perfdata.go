@@ -0,0 +1,139 @@
+package monzero
+
+import (
+	"strconv"
+	"strings"
+)
+
+type (
+	// PerfData is a single value of the performance data of a check in the
+	// format of nagios plugins:
+	//
+	//	'label'=value[unit];[warn];[crit];[min];[max]
+	PerfData struct {
+		Label string
+		Value float64
+		Unit  string
+		// Warn and Crit are the thresholds as nagios ranges, like `10:20`.
+		Warn string
+		Crit string
+		Min  *float64
+		Max  *float64
+	}
+)
+
+// ParsePerfData splits the output of a nagios plugin into the message and
+// the performance data.
+//
+// The performance data follows a `|` in the first line of the output. Further
+// performance data can follow a `|` in the long output, after which all lines
+// contain performance data. Values which can not be parsed are skipped.
+func ParsePerfData(output string) (string, []PerfData) {
+	lines := strings.Split(output, "\n")
+	message := []string{}
+	raw := []string{}
+
+	first := strings.SplitN(lines[0], "|", 2)
+	message = append(message, strings.TrimRight(first[0], " "))
+	if len(first) == 2 {
+		raw = append(raw, first[1])
+	}
+	inPerfData := false
+	for _, line := range lines[1:] {
+		if inPerfData {
+			raw = append(raw, line)
+			continue
+		}
+		parts := strings.SplitN(line, "|", 2)
+		message = append(message, parts[0])
+		if len(parts) == 2 {
+			raw = append(raw, parts[1])
+			inPerfData = true
+		}
+	}
+
+	perfData := []PerfData{}
+	for _, line := range raw {
+		for _, item := range splitPerfData(line) {
+			if p, ok := parsePerfDataItem(item); ok {
+				perfData = append(perfData, p)
+			}
+		}
+	}
+	return strings.TrimRight(strings.Join(message, "\n"), "\n "), perfData
+}
+
+// splitPerfData splits a line of performance data at spaces outside of
+// quoted labels.
+func splitPerfData(line string) []string {
+	items := []string{}
+	current := strings.Builder{}
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+		case r == ' ' && !quoted:
+			if current.Len() > 0 {
+				items = append(items, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		items = append(items, current.String())
+	}
+	return items
+}
+
+// parsePerfDataItem parses a single value of the performance data.
+func parsePerfDataItem(item string) (PerfData, bool) {
+	p := PerfData{}
+	pos := strings.LastIndex(item, "=")
+	if pos < 1 {
+		return p, false
+	}
+	p.Label = item[:pos]
+	if len(p.Label) >= 2 && p.Label[0] == '\'' && p.Label[len(p.Label)-1] == '\'' {
+		p.Label = strings.ReplaceAll(p.Label[1:len(p.Label)-1], "''", "'")
+	}
+	if p.Label == "" {
+		return p, false
+	}
+
+	fields := strings.Split(item[pos+1:], ";")
+	value := fields[0]
+	end := len(value)
+	for end > 0 && !strings.ContainsRune("0123456789.", rune(value[end-1])) {
+		end--
+	}
+	var err error
+	if p.Value, err = strconv.ParseFloat(value[:end], 64); err != nil {
+		return p, false
+	}
+	p.Unit = value[end:]
+	if len(fields) > 1 {
+		p.Warn = fields[1]
+	}
+	if len(fields) > 2 {
+		p.Crit = fields[2]
+	}
+	if len(fields) > 3 {
+		p.Min = parsePerfDataFloat(fields[3])
+	}
+	if len(fields) > 4 {
+		p.Max = parsePerfDataFloat(fields[4])
+	}
+	return p, true
+}
+
+func parsePerfDataFloat(raw string) *float64 {
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil
+	}
+	return &val
+}
@@ -0,0 +1,57 @@
+package monzero
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePerfData(t *testing.T) {
+	f := func(val float64) *float64 { return &val }
+	type S struct {
+		output   string
+		message  string
+		perfData []PerfData
+	}
+	for i, e := range []S{
+		S{"PING OK - Packet loss = 0%", "PING OK - Packet loss = 0%", []PerfData{}},
+		S{
+			"PING OK - Packet loss = 0%, RTA = 0.05 ms|rta=0.053000ms;100.000000;500.000000;0.000000 pl=0%;20;60;0",
+			"PING OK - Packet loss = 0%, RTA = 0.05 ms",
+			[]PerfData{
+				{Label: "rta", Value: 0.053, Unit: "ms", Warn: "100.000000", Crit: "500.000000", Min: f(0)},
+				{Label: "pl", Value: 0, Unit: "%", Warn: "20", Crit: "60", Min: f(0)},
+			},
+		},
+		S{
+			"DISK OK | '/ free'=10GB;;;0;100 'it''s'=5",
+			"DISK OK",
+			[]PerfData{
+				{Label: "/ free", Value: 10, Unit: "GB", Min: f(0), Max: f(100)},
+				{Label: "it's", Value: 5},
+			},
+		},
+		S{
+			"DISK OK\n/ 10% used\n/var 20% used | /=10%;80:90;@95\n/var=20%",
+			"DISK OK\n/ 10% used\n/var 20% used",
+			[]PerfData{
+				{Label: "/", Value: 10, Unit: "%", Warn: "80:90", Crit: "@95"},
+				{Label: "/var", Value: 20, Unit: "%"},
+			},
+		},
+		S{
+			"OK | time=-1.5s invalid=U novalue= =4",
+			"OK",
+			[]PerfData{
+				{Label: "time", Value: -1.5, Unit: "s"},
+			},
+		},
+	} {
+		message, perfData := ParsePerfData(e.output)
+		if message != e.message {
+			t.Errorf("test %d: expected message %q, got %q", i, e.message, message)
+		}
+		if !reflect.DeepEqual(perfData, e.perfData) {
+			t.Errorf("test %d: expected perfdata %+v, got %+v", i, e.perfData, perfData)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+-- the host generating the notification
+alter table notifications add column if not exists check_host text;
+
+-- the type of a notifier is selected through its settings. Existing notifiers
+-- without a type write their notifications to the log.
+update notifier set settings = settings || '{"type": "log"}' where not settings ? 'type';
+
+-- the result of the notifier, like the exit code and output of a command
+alter table notifications add result_code integer;
+alter table notifications add result_output text;
+
+-- delivery status of notifications
+alter table notifications add status text not null default 'pending'
+  check (status in ('pending', 'sent', 'failed', 'suppressed'));
+alter table notifications add attempts integer not null default 0;
+alter table notifications add last_error text;
+alter table notifications add next_try timestamp with time zone default now();
+-- notifications created before monnotify were never delivered and would all
+-- be sent on its first start. Mark them as handled before starting monnotify.
+update notifications set status = 'suppressed', next_try = null,
+  last_error = 'created before monnotify'
+  where sent is null;
+update notifications set status = 'sent', next_try = null where sent is not null;
+create index on notifications using btree (next_try) where status = 'pending';
+
+-- remind about checks which are still not okay
+alter table notifier add renotify_interval interval;
+
+-- soft and hard states
+alter table checks add max_attempts integer not null default 1;
+alter table checks add retry_intval interval;
+alter table active_checks add max_attempts integer not null default 1;
+alter table active_checks add retry_intval interval;
+alter table active_checks add attempt integer not null default 0;
+alter table active_checks add hard_state integer not null default 0;
+
+-- flap detection
+alter table active_checks add history integer[] not null default '{}';
+alter table active_checks add flapping boolean not null default false;
+alter table checks add flap_window integer not null default 21;
+alter table checks add flap_start double precision not null default 0.5;
+alter table checks add flap_stop double precision not null default 0.25;
+alter table checks add constraint checks_flap_check check (flap_stop <= flap_start and flap_start <= 1);
+alter table active_checks add flap_window integer not null default 21;
+alter table active_checks add flap_start double precision not null default 0.5;
+alter table active_checks add flap_stop double precision not null default 0.25;
+
+-- scheduled downtimes for checks, nodes or groups
+create table downtimes(
+  id bigserial not null primary key,
+  check_id bigint references checks(id) on delete cascade,
+  node_id bigint references nodes(id) on delete cascade,
+  group_id integer,
+  starts timestamp with time zone not null default now(),
+  ends timestamp with time zone not null,
+  author text not null,
+  comment text not null,
+  created timestamp with time zone not null default now(),
+  check (num_nonnulls(check_id, node_id, group_id) = 1),
+  check (starts < ends)
+);
+create index on downtimes using btree (ends);
+
+-- check_in_downtime returns true, when the check, its node or one of the
+-- node's groups is in a downtime right now.
+create function check_in_downtime(bigint) returns boolean as $$
+  select exists(select 1
+    from downtimes d
+    join checks c on c.id = $1
+    where now() between d.starts and d.ends
+      and (d.check_id = c.id
+        or d.node_id = c.node_id
+        or d.group_id in (select group_id from nodes_groups where node_id = c.node_id)));
+$$ language sql stable;
+
+-- acknowledgements with author, comment, expiry and stickiness
+alter table active_checks add ack_author text;
+alter table active_checks add ack_comment text;
+alter table active_checks add ack_time timestamp with time zone;
+alter table active_checks add ack_expires timestamp with time zone;
+alter table active_checks add ack_sticky boolean not null default false;
+
+-- escalation of problems which are not acknowledged in time
+create table escalation_policies(
+  id serial not null primary key,
+  name text not null unique,
+  description text not null default ''
+);
+create table escalation_steps(
+  id serial not null primary key,
+  policy_id integer not null references escalation_policies(id) on delete cascade,
+  step integer not null check (step > 0),
+  delay interval not null,
+  notifier_id integer not null references notifier(id),
+  unique(policy_id, step)
+);
+alter table checks add escalation_policy_id integer references escalation_policies(id);
+alter table active_checks add escalation_step integer not null default 0;
+alter table active_checks add hard_since timestamp with time zone not null default now();
+alter table notifications add escalation_step integer;
+
+-- time periods in which notifications are delivered
+create table timeperiods(
+  id serial not null primary key,
+  name text not null unique,
+  timezone text not null default 'UTC',
+  -- what happens to notifications outside of the period
+  outside text not null default 'hold' check (outside in ('hold', 'drop'))
+);
+create table timeperiod_ranges(
+  id serial not null primary key,
+  timeperiod_id integer not null references timeperiods(id) on delete cascade,
+  -- 0 is sunday
+  weekday integer not null check (weekday between 0 and 6),
+  starts time not null,
+  ends time not null,
+  check (starts < ends)
+);
+alter table notifier add timeperiod_id integer references timeperiods(id);
+alter table checks_notify add timeperiod_id integer references timeperiods(id);
+
+-- deliver the notifications of a notifier created in a window as one digest
+alter table notifier add batch_window interval;
+create table digests(
+  id bigserial not null primary key,
+  notifier_id integer not null references notifier(id),
+  created timestamp with time zone not null default now(),
+  notifications integer not null default 0,
+  status text not null default 'pending' check (status in ('pending', 'sent', 'failed')),
+  last_error text,
+  result_code integer,
+  result_output text
+);
+alter table notifications add digest_id bigint references digests(id) on delete set null;
+
+-- native http checks configured through the options of the check
+alter table active_checks add options jsonb not null default '{}'::jsonb;
+insert into checkers(name, description) values ('http', 'http runs HTTP(S) requests in moncheck itself. It is configured through the options of the check.');
+
+-- native tcp and tls certificate checks
+insert into checkers(name, description) values ('tcp', 'tcp connects to a port in moncheck itself and checks the TLS certificates. It is configured through the options of the check.');
+
+-- native dns checks
+insert into checkers(name, description) values ('dns', 'dns resolves names in moncheck itself and compares the answers. It is configured through the options of the check.');
+
+-- performance data of the checks
+create table check_metrics(
+  time timestamp with time zone not null default now(),
+  check_id bigint not null references checks(id) on delete cascade,
+  label text not null,
+  value double precision not null,
+  unit text not null default '',
+  warn text,
+  crit text,
+  min double precision,
+  max double precision
+);
+create index on check_metrics using btree (check_id, label, time);
+
+-- history of all check results
+create table check_results(
+  id bigserial not null primary key,
+  check_id bigint not null references checks(id) on delete cascade,
+  time timestamp with time zone not null default now(),
+  exit_code integer not null,
+  duration interval not null,
+  output text not null,
+  host text not null
+);
+create index on check_results using btree (check_id, time);
+create index on check_results using btree (time);
+create index on check_metrics using btree (time);
+
+-- passive checks receive their results through monfront
+insert into checkers(name, description) values ('passive', 'passive checks are never run by moncheck. Their results are submitted to monfront.');
+
+-- running instances of the checkers
+create table checker_instances(
+  id bigserial not null primary key,
+  checker_id integer not null references checkers(id) on delete cascade,
+  hostname text not null,
+  version text not null,
+  workers integer not null,
+  started timestamp with time zone not null default now(),
+  heartbeat timestamp with time zone not null default now(),
+  heartbeat_intval interval not null,
+  -- number of checks run, checks per second since the last heartbeat
+  checks bigint not null default 0,
+  rate double precision not null default 0,
+  errors bigint not null default 0,
+  last_error text,
+  last_error_time timestamp with time zone
+);
+create index on checker_instances using btree (checker_id, heartbeat);
+-- an instance is dead after missing three heartbeats
+create view checker_instances_alive as
+  select i.*, i.heartbeat >= now() - 3 * i.heartbeat_intval as alive
+  from checker_instances i;
+-- passive check receiving the state of the live instances of the checker
+alter table checkers add liveness_check_id bigint references checks(id) on delete set null;
+
+-- last run of a check, how long it took and which host ran it
+alter table active_checks add last_run timestamp with time zone;
+alter table active_checks add duration interval;
+alter table active_checks add executed_by text;
+-- checks which regularly use most of their timeout
+alter table active_checks add slow_runs integer not null default 0;
+alter table active_checks add slow boolean not null default false;
+
+-- timeout of a check overriding the timeout of moncheck, with the exit code
+-- and message of a check hitting the timeout
+alter table checks add timeout interval;
+alter table checks add timeout_exit_code integer;
+alter table checks add timeout_message text;
+alter table active_checks add timeout interval;
+alter table active_checks add timeout_exit_code integer;
+alter table active_checks add timeout_message text;
@@ -0,0 +1,46 @@
+package monzero
+
+// hardState computes the new hard state and attempt counter of a check after
+// it returned exitCode.
+//
+// A result other than okay first becomes a soft state, which only turns into
+// a hard state after maxAttempts consecutive results other than okay. Once
+// a check is in a hard state other than okay, every further change is a hard
+// state change. The recovery to okay is always a hard state change.
+func hardState(hard, attempt, maxAttempts, exitCode int) (int, int) {
+	if exitCode == 0 {
+		return 0, 0
+	}
+	attempt += 1
+	if hard != 0 || attempt >= maxAttempts {
+		return exitCode, attempt
+	}
+	return hard, attempt
+}
+
+// flapping computes if a check is flapping from the history of exit codes,
+// the newest first.
+//
+// The flap ratio is the share of changes between okay and not okay in the
+// history. A check starts flapping when the ratio reaches start and the
+// history has at least window entries. It stops flapping, when the ratio
+// falls to stop or below.
+func flapping(history []int, window int, was bool, start, stop float64) bool {
+	if window < 2 || len(history) < 2 {
+		return false
+	}
+	if len(history) > window {
+		history = history[:window]
+	}
+	changes := 0
+	for i := 1; i < len(history); i++ {
+		if (history[i] == 0) != (history[i-1] == 0) {
+			changes++
+		}
+	}
+	ratio := float64(changes) / float64(len(history)-1)
+	if was {
+		return ratio > stop
+	}
+	return len(history) >= window && ratio >= start
+}
@@ -0,0 +1,50 @@
+package monzero
+
+import (
+	"testing"
+)
+
+func TestHardState(t *testing.T) {
+	type S struct {
+		hard, attempt, maxAttempts, exitCode int
+		newHard, newAttempt                  int
+	}
+	for i, e := range []S{
+		S{0, 0, 1, 0, 0, 0},
+		S{0, 0, 1, 2, 2, 1},
+		S{0, 0, 3, 2, 0, 1},
+		S{0, 1, 3, 1, 0, 2},
+		S{0, 2, 3, 2, 2, 3},
+		S{2, 3, 3, 1, 1, 4},
+		S{0, 2, 3, 0, 0, 0},
+		S{2, 5, 3, 0, 0, 0},
+	} {
+		hard, attempt := hardState(e.hard, e.attempt, e.maxAttempts, e.exitCode)
+		if hard != e.newHard || attempt != e.newAttempt {
+			t.Errorf("test %d: expected hard state %d and attempt %d, got %d and %d",
+				i, e.newHard, e.newAttempt, hard, attempt)
+		}
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	type S struct {
+		history  []int
+		was      bool
+		flapping bool
+	}
+	for i, e := range []S{
+		S{[]int{}, false, false},
+		S{[]int{0, 2, 0, 2}, false, false},
+		S{[]int{0, 2, 0, 2, 0, 2}, false, true},
+		S{[]int{0, 2, 0, 2, 0, 2, 0, 0, 0}, false, true},
+		S{[]int{0, 0, 0, 0, 0, 2}, false, false},
+		S{[]int{2, 1, 2, 1, 2, 1}, false, false},
+		S{[]int{0, 0, 0, 2, 0, 2}, true, true},
+		S{[]int{0, 0, 0, 0, 0, 2}, true, false},
+	} {
+		if result := flapping(e.history, 6, e.was, 0.5, 0.25); result != e.flapping {
+			t.Errorf("test %d: expected flapping to be %t, got %t", i, e.flapping, result)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package monzero
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// TimePeriodHold delays notifications outside of a time period until the
+	// period opens again.
+	TimePeriodHold = "hold"
+	// TimePeriodDrop suppresses notifications outside of a time period.
+	TimePeriodDrop = "drop"
+)
+
+type (
+	// TimePeriod defines when notifications may be delivered.
+	TimePeriod struct {
+		Name string
+		// Location is the timezone the ranges are defined in.
+		Location *time.Location
+		Ranges   []TimeRange
+		// Outside defines what happens to notifications outside of the
+		// period. It is either TimePeriodHold or TimePeriodDrop.
+		Outside string
+	}
+
+	// TimeRange is a range of time on a weekday. Start and End are the
+	// offsets from midnight, where End is not part of the range.
+	TimeRange struct {
+		Weekday time.Weekday
+		Start   time.Duration
+		End     time.Duration
+	}
+)
+
+// Contains returns true, when t is in one of the ranges of the period.
+func (p TimePeriod) Contains(t time.Time) bool {
+	t = t.In(p.location())
+	offset := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+	for _, r := range p.Ranges {
+		if r.Weekday == t.Weekday() && r.Start <= offset && offset < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Opens returns the next time after t at which the period opens. When the
+// period has no ranges, the zero time is returned.
+func (p TimePeriod) Opens(t time.Time) time.Time {
+	t = t.In(p.location())
+	next := time.Time{}
+	for day := 0; day <= 7; day++ {
+		date := time.Date(t.Year(), t.Month(), t.Day()+day, 0, 0, 0, 0, t.Location())
+		for _, r := range p.Ranges {
+			if r.Weekday != date.Weekday() || r.Start >= r.End {
+				continue
+			}
+			start := time.Date(date.Year(), date.Month(), date.Day(),
+				0, 0, int(r.Start/time.Second), 0, date.Location())
+			if start.Before(t) {
+				continue
+			}
+			if next.IsZero() || start.Before(next) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
+
+// Apply decides what happens to a notification at t. When deliver is false
+// and holdUntil is not zero, the notification must be held until then.
+// Otherwise it must be dropped.
+func (p TimePeriod) Apply(t time.Time) (deliver bool, holdUntil time.Time) {
+	if p.Contains(t) {
+		return true, time.Time{}
+	}
+	if p.Outside == TimePeriodDrop {
+		return false, time.Time{}
+	}
+	return false, p.Opens(t)
+}
+
+func (p TimePeriod) location() *time.Location {
+	if p.Location == nil {
+		return time.UTC
+	}
+	return p.Location
+}
+
+// loadTimePeriod loads the time period with its ranges.
+func loadTimePeriod(tx *sql.Tx, id int64) (TimePeriod, error) {
+	p := TimePeriod{}
+	var timezone string
+	if err := tx.QueryRow(`select name, timezone, outside from timeperiods where id = $1`, id).
+		Scan(&p.Name, &timezone, &p.Outside); err != nil {
+		return p, fmt.Errorf("could not load time period '%d': %w", id, err)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return p, fmt.Errorf("could not load timezone of time period '%s': %w", p.Name, err)
+	}
+	p.Location = loc
+
+	rows, err := tx.Query(`select weekday, extract(epoch from starts)::bigint, extract(epoch from ends)::bigint
+		from timeperiod_ranges
+		where timeperiod_id = $1`, id)
+	if err != nil {
+		return p, fmt.Errorf("could not load ranges of time period '%s': %w", p.Name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var weekday int
+		var start, end int64
+		if err := rows.Scan(&weekday, &start, &end); err != nil {
+			return p, fmt.Errorf("could not scan range of time period '%s': %w", p.Name, err)
+		}
+		p.Ranges = append(p.Ranges, TimeRange{
+			Weekday: time.Weekday(weekday),
+			Start:   time.Duration(start) * time.Second,
+			End:     time.Duration(end) * time.Second,
+		})
+	}
+	return p, rows.Err()
+}
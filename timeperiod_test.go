@@ -0,0 +1,56 @@
+package monzero
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimePeriodApply(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data not available: %s", err)
+	}
+	workdays := []TimeRange{}
+	for day := time.Monday; day <= time.Friday; day++ {
+		workdays = append(workdays, TimeRange{day, 9 * time.Hour, 17 * time.Hour})
+	}
+	at := func(s string) time.Time {
+		result, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			t.Fatalf("could not parse time %s: %s", s, err)
+		}
+		return result
+	}
+
+	type S struct {
+		period    TimePeriod
+		now       time.Time
+		deliver   bool
+		holdUntil time.Time
+	}
+	for i, e := range []S{
+		// 2026-10-14 is a wednesday
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-14 10:00"), true, time.Time{}},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-14 09:00"), true, time.Time{}},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-14 17:00"), false, at("2026-10-15 09:00")},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-14 06:30"), false, at("2026-10-14 09:00")},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-16 18:00"), false, at("2026-10-19 09:00")},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-17 12:00"), false, at("2026-10-19 09:00")},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodDrop}, at("2026-10-14 10:00"), true, time.Time{}},
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodDrop}, at("2026-10-14 18:00"), false, time.Time{}},
+		// the timezone of the period is used and not the one of the time
+		S{TimePeriod{Location: berlin, Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-14 10:00").UTC(), true, time.Time{}},
+		S{TimePeriod{Ranges: workdays, Outside: TimePeriodHold}, at("2026-10-14 08:30"), false, at("2026-10-14 11:00")},
+		// a period without ranges never opens
+		S{TimePeriod{Location: berlin, Outside: TimePeriodHold}, at("2026-10-14 10:00"), false, time.Time{}},
+		// the period opens after the change to winter time on 2026-10-25
+		S{TimePeriod{Location: berlin, Ranges: []TimeRange{{time.Sunday, 6 * time.Hour, 7 * time.Hour}}, Outside: TimePeriodHold},
+			at("2026-10-24 12:00"), false, at("2026-10-25 06:00")},
+	} {
+		deliver, holdUntil := e.period.Apply(e.now)
+		if deliver != e.deliver || !holdUntil.Equal(e.holdUntil) {
+			t.Errorf("test %d: expected deliver %t and hold until %s, got %t and %s",
+				i, e.deliver, e.holdUntil, deliver, holdUntil)
+		}
+	}
+}